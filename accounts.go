@@ -0,0 +1,134 @@
+/**
+* This file contains the loyalty accounts. A receipt sent to receipts/process with an
+* accountId earns its points for that account.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A loyalty account that receipts can be attached to.
+type Account struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// Models a request to the accounts endpoint.
+type CreateAccountRequest struct {
+	Name string `json:"name"`
+}
+
+// Models a response to the accounts endpoint.
+type CreateAccountResponse struct {
+	Id string `json:"id"`
+}
+
+// Models a response to the accounts/{id}/balance endpoint.
+type BalanceResponse struct {
+	AccountId string `json:"accountId"`
+	Points    int64  `json:"points"`
+}
+
+// Models a response to the accounts/{id}/receipts endpoint.
+type AccountReceiptsResponse struct {
+	Receipts []AccountReceipt `json:"receipts"`
+}
+
+type AccountReceipt struct {
+	Id           string    `json:"id"`
+	Retailer     string    `json:"retailer"`
+	PurchaseDate string    `json:"purchaseDate"`
+	Total        string    `json:"total"`
+	Points       int64     `json:"points"`
+	ProcessedAt  time.Time `json:"processedAt"`
+	DuplicateOf  string    `json:"duplicateOf,omitempty"`
+}
+
+/**
+* Handler for the /accounts path. Creates a new account.
+ */
+func createAccountHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	var createRequest CreateAccountRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &createRequest); err != nil {
+			respond(http.StatusBadRequest, InvalidAccountResponse, res)
+			return
+		}
+	}
+
+	account := &Account{Id: uuid.New().String(), Name: createRequest.Name, CreatedAt: time.Now().UTC()}
+	if err := store.InsertAccount(account); err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(CreateAccountResponse{account.Id}, res)
+}
+
+/**
+* Handler for the /accounts/{id}/balance path. The balance is derived from the account's
+* ledger: the points its receipts earned, less redemptions, plus or minus adjustments.
+* Receipts accepted as duplicates earn nothing.
+ */
+func balanceHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return
+	}
+
+	entries, err := store.GetLedger(account.Id)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(BalanceResponse{account.Id, balance(entries)}, res)
+}
+
+/**
+* Handler for the /accounts/{id}/receipts path. Lists the account's receipts, oldest
+* first.
+ */
+func accountReceiptsHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return
+	}
+
+	receipts, err := store.GetAccountReceipts(account.Id)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	receiptsResponse := AccountReceiptsResponse{Receipts: make([]AccountReceipt, len(receipts))}
+	for i, stored := range receipts {
+		receiptsResponse.Receipts[i] = AccountReceipt{
+			Id:           stored.Id,
+			Retailer:     stored.Receipt.Retailer,
+			PurchaseDate: stored.Receipt.Localized().PurchaseDate,
+			Total:        stored.Receipt.Total,
+			Points:       stored.Points,
+			ProcessedAt:  stored.ProcessedAt,
+			DuplicateOf:  stored.DuplicateOf,
+		}
+	}
+
+	respondJSON(receiptsResponse, res)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createTestAccount(t *testing.T, store Store) string {
+	req := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"name": "Daniel"}`))
+	w := httptest.NewRecorder()
+	createAccountHandler(store, w, req)
+	if w.Result().StatusCode != 200 {
+		t.Fatal("Could not create an account")
+	}
+
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var createResponse CreateAccountResponse
+	json.Unmarshal(data, &createResponse)
+	return createResponse.Id
+}
+
+func receiptForAccount(accountId string, date string) io.Reader {
+	return strings.NewReader(`{
+		"accountId": "` + accountId + `",
+		"retailer": "-",
+		"purchaseDate": "` + date + `",
+		"purchaseTime": "14:00",
+		"items": [{ "shortDescription": "Hi", "price": "2.25" }],
+		"total": "9.00"
+	  }`)
+}
+
+func processForAccount(store Store, accountId string, date string) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", receiptForAccount(accountId, date))
+	w := httptest.NewRecorder()
+	processHandler(store, testRulebook, defaultConfig, w, req)
+	return w.Result()
+}
+
+func TestAccounts_AccumulatePoints(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	otherAccountId := createTestAccount(t, testStore)
+
+	// 75 points for the total, plus 6 on the odd day.
+	processForAccount(testStore, accountId, "2022-03-20")
+	processForAccount(testStore, accountId, "2022-03-21")
+	processForAccount(testStore, otherAccountId, "2022-03-22")
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/balance", nil)
+	w := httptest.NewRecorder()
+	balanceHandler(testStore, w, req)
+	if w.Result().StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var balanceResponse BalanceResponse
+	json.Unmarshal(data, &balanceResponse)
+	if balanceResponse.AccountId != accountId || balanceResponse.Points != 156 {
+		t.Errorf("Invalid balance: %s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/receipts", nil)
+	w = httptest.NewRecorder()
+	accountReceiptsHandler(testStore, w, req)
+	data, _ = ioutil.ReadAll(w.Result().Body)
+	var receiptsResponse AccountReceiptsResponse
+	json.Unmarshal(data, &receiptsResponse)
+	if len(receiptsResponse.Receipts) != 2 ||
+		receiptsResponse.Receipts[0].PurchaseDate != "2022-03-20" || receiptsResponse.Receipts[1].Points != 81 {
+		t.Errorf("Invalid receipts: %s", data)
+	}
+}
+
+func TestAccounts_RefusesUnknownAccount(t *testing.T) {
+	testStore := newMemStore()
+	res := processForAccount(testStore, "8e55ce4d-4d0d-4765-babd-294711efc91b", "2022-03-20")
+	if res.StatusCode != 400 {
+		t.Error("Getting an incorrect status code")
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	if len(problem.Errors) != 1 || problem.Errors[0].Code != UnknownAccountCode {
+		t.Errorf("Invalid problem: %s", data)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/8e55ce4d-4d0d-4765-babd-294711efc91b/balance", nil)
+	w := httptest.NewRecorder()
+	balanceHandler(testStore, w, req)
+	if w.Result().StatusCode != 404 {
+		t.Error("Getting an incorrect status code")
+	}
+}
@@ -0,0 +1,158 @@
+/**
+* This file contains the promotional campaigns. Campaigns are managed at runtime through
+* the campaigns endpoints and apply to every receipt processed while they are stored.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+)
+
+// Models a response to the campaigns endpoint.
+type CampaignsResponse struct {
+	Campaigns []*receipt.Campaign `json:"campaigns"`
+}
+
+/**
+* Adds up the points that each campaign awarded to the receipts of an account, by
+* campaign id. Receipts accepted as duplicates earned nothing.
+ */
+func campaignEarnings(receipts []*StoredReceipt) map[string]int64 {
+	earned := map[string]int64{}
+	for _, stored := range receipts {
+		if stored.DuplicateOf != "" {
+			continue
+		}
+		for _, rule := range stored.Rules {
+			if rule.Campaign != "" {
+				earned[rule.Campaign] += rule.Points
+			}
+		}
+	}
+
+	return earned
+}
+
+/**
+* Reads and validates the campaign in the body of the request. If it can't, the problem
+* has already been sent and false is returned.
+ */
+func readCampaign(res http.ResponseWriter, req *http.Request) (*receipt.Campaign, bool) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return nil, false
+	}
+
+	var campaign receipt.Campaign
+	err = json.Unmarshal(body, &campaign)
+	if err == nil {
+		err = campaign.Validate()
+	}
+	if err != nil {
+		problem := invalidProblem(err)
+		problem.Title = InvalidCampaignResponse
+		respondProblem(problem, res)
+		return nil, false
+	}
+
+	return &campaign, true
+}
+
+/**
+* Handler for POST on the /campaigns path. Stores a new campaign under a fresh id.
+ */
+func createCampaignHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	campaign, ok := readCampaign(res, req)
+	if !ok {
+		return
+	}
+
+	campaign.Id = uuid.New().String()
+	if err := store.PutCampaign(campaign); err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(campaign, res)
+}
+
+/**
+* Handler for GET on the /campaigns path. Lists every stored campaign, active or not.
+ */
+func campaignsHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	campaigns, err := store.GetCampaigns()
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	campaignsResponse := CampaignsResponse{Campaigns: campaigns}
+	if campaignsResponse.Campaigns == nil {
+		campaignsResponse.Campaigns = []*receipt.Campaign{}
+	}
+
+	respondJSON(campaignsResponse, res)
+}
+
+/**
+* Handler for GET on the /campaigns/{id} path.
+ */
+func campaignHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	campaign, found := findCampaign(store, req)
+	if !found {
+		respond(http.StatusNotFound, CampaignNotFoundResponse, res)
+		return
+	}
+
+	respondJSON(campaign, res)
+}
+
+/**
+* Handler for PUT on the /campaigns/{id} path. Replaces the campaign. Receipts that were
+* already processed keep the points the old campaign gave them.
+ */
+func updateCampaignHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	existing, found := findCampaign(store, req)
+	if !found {
+		respond(http.StatusNotFound, CampaignNotFoundResponse, res)
+		return
+	}
+
+	campaign, ok := readCampaign(res, req)
+	if !ok {
+		return
+	}
+
+	campaign.Id = existing.Id
+	if err := store.PutCampaign(campaign); err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(campaign, res)
+}
+
+/**
+* Handler for DELETE on the /campaigns/{id} path.
+ */
+func deleteCampaignHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	campaign, found := findCampaign(store, req)
+	if !found {
+		respond(http.StatusNotFound, CampaignNotFoundResponse, res)
+		return
+	}
+
+	if err := store.DeleteCampaign(campaign.Id); err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
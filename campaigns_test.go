@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+)
+
+func sendCampaign(handler func(Store, http.ResponseWriter, *http.Request), store Store, method string, path string, body string) *http.Response {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(store, w, req)
+	return w.Result()
+}
+
+func TestCampaigns_ManagedAtRuntime(t *testing.T) {
+	testStore := newMemStore()
+
+	res := sendCampaign(createCampaignHandler, testStore, http.MethodPost, "/campaigns", `{"name": "Bad", "start": "2022-03-01"}`)
+	if res.StatusCode != 400 || res.Header.Get("Content-Type") != "application/problem+json" {
+		t.Error("Invalid campaign should be refused")
+	}
+
+	res = sendCampaign(createCampaignHandler, testStore, http.MethodPost, "/campaigns", `{"name": "Spring", "start": "2022-03-01", "end": "2022-03-31", "bonus": 100}`)
+	data, _ := ioutil.ReadAll(res.Body)
+	var campaign receipt.Campaign
+	json.Unmarshal(data, &campaign)
+	if res.StatusCode != 200 || campaign.Id == "" {
+		t.Fatalf("Could not create the campaign: %s", data)
+	}
+
+	path := "/campaigns/" + campaign.Id
+	res = sendCampaign(updateCampaignHandler, testStore, http.MethodPut, path, `{"name": "Spring", "start": "2022-03-01", "end": "2022-03-31", "bonus": 20, "accountCap": 30}`)
+	if res.StatusCode != 200 {
+		t.Error("Could not update the campaign")
+	}
+	res = sendCampaign(campaignHandler, testStore, http.MethodGet, path, "")
+	data, _ = ioutil.ReadAll(res.Body)
+	json.Unmarshal(data, &campaign)
+	if campaign.Bonus != 20 || campaign.AccountCap != 30 {
+		t.Errorf("Campaign was not updated: %s", data)
+	}
+
+	// The cap leaves 10 points for the second receipt, and the third is outside the dates.
+	accountId := createTestAccount(t, testStore)
+	processForAccount(testStore, accountId, "2022-03-20")
+	processForAccount(testStore, accountId, "2022-03-21")
+	processForAccount(testStore, accountId, "2022-04-01")
+	if balance := getBalance(testStore, accountId); balance != 75+20+81+10+81 {
+		t.Errorf("Invalid balance with the campaign: %d", balance)
+	}
+
+	res = sendCampaign(deleteCampaignHandler, testStore, http.MethodDelete, path, "")
+	if res.StatusCode != 204 {
+		t.Error("Could not delete the campaign")
+	}
+	res = sendCampaign(campaignsHandler, testStore, http.MethodGet, "/campaigns", "")
+	data, _ = ioutil.ReadAll(res.Body)
+	if string(data) != `{"campaigns":[]}` {
+		t.Errorf("Campaign is still listed: %s", data)
+	}
+	res = sendCampaign(campaignHandler, testStore, http.MethodGet, path, "")
+	if res.StatusCode != 404 {
+		t.Error("Deleted campaign was found")
+	}
+}
+
+func TestCampaigns_CapHoldsWithinABatch(t *testing.T) {
+	testStore := newMemStore()
+	campaign := &receipt.Campaign{Id: uuid.New().String(), Name: "Spring", Start: "2022-03-01", End: "2022-03-31", Bonus: 100, AccountCap: 100}
+	testStore.PutCampaign(campaign)
+	accountId := createTestAccount(t, testStore)
+
+	var receipts []string
+	for day := 10; day < 20; day++ {
+		data, _ := ioutil.ReadAll(receiptForAccount(accountId, fmt.Sprintf("2022-03-%d", day)))
+		receipts = append(receipts, string(data))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", strings.NewReader("["+strings.Join(receipts, ",")+"]"))
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+	if w.Result().StatusCode != 200 {
+		t.Fatal("Could not process the batch")
+	}
+
+	stored, _ := testStore.GetAccountReceipts(accountId)
+	if earned := campaignEarnings(stored)[campaign.Id]; len(stored) != 10 || earned != 100 {
+		t.Errorf("Expected 100 campaign points over 10 receipts, got %d over %d", earned, len(stored))
+	}
+}
+
+func TestCampaigns_CapHoldsForReceiptsScoredTogether(t *testing.T) {
+	testStore := newMemStore()
+	testStore.PutCampaign(&receipt.Campaign{Id: uuid.New().String(), Name: "Spring", Start: "2022-03-01", End: "2022-03-31", Bonus: 100, AccountCap: 150})
+	accountId := createTestAccount(t, testStore)
+
+	// Both are scored before either is stored, as concurrent requests would be.
+	var scored []*StoredReceipt
+	for _, date := range []string{"2022-03-20", "2022-03-21"} {
+		var request ProcessRequest
+		data, _ := ioutil.ReadAll(receiptForAccount(accountId, date))
+		json.Unmarshal(data, &request)
+		stored, err := scoreReceipt(testStore, testRulebook, defaultConfig, request, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scored = append(scored, stored)
+	}
+	for _, stored := range scored {
+		if err := testStore.InsertReceipt(stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if scored[1].Points != 81+50 {
+		t.Errorf("Expected the second receipt to be capped to 50 campaign points: %+v", scored[1].Rules)
+	}
+	if balance := getBalance(testStore, accountId); balance != 75+100+81+50 {
+		t.Errorf("Invalid balance with the cap: %d", balance)
+	}
+}
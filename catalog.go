@@ -0,0 +1,275 @@
+/**
+* This file contains the retailer catalog. Every receipt's retailer is matched to an
+* entry of the catalog when it is processed, so that receipts can be grouped by retailer
+* however the name was printed on them.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+)
+
+// A retailer in the catalog. Receipts are matched to it by its name and aliases.
+type Retailer struct {
+	Id      string
+	Name    string
+	Aliases []string
+}
+
+// Models a request to the retailers endpoint.
+type RetailerRequest struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// Models a request to the retailers/{id}/merge endpoint: the retailers to merge into the
+// one in the path.
+type MergeRequest struct {
+	RetailerIds []string `json:"retailerIds"`
+}
+
+// Models a retailer in the responses of the retailers endpoints.
+type RetailerResponse struct {
+	Id       string   `json:"id"`
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Receipts int      `json:"receipts"`
+}
+
+// Models a response to the retailers endpoint.
+type RetailersResponse struct {
+	Retailers []RetailerResponse `json:"retailers"`
+}
+
+// How similar, from 0 to 1, a retailer name must be to an entry to match it without
+// being one of its names. Names shorter than minimumFuzzyLength must match exactly.
+const (
+	retailerSimilarity = 0.8
+	minimumFuzzyLength = 5
+)
+
+/**
+* Finds the catalog entry for a retailer name as printed on a receipt. An entry matches
+* if one of its names has the same key, or failing that if it is the most similar entry
+* and similar enough. Returns nil if no entry matches.
+ */
+func matchRetailer(catalog []*Retailer, name string) *Retailer {
+	key := receipt.NormalizeRetailer(name)
+	if key == "" {
+		return nil
+	}
+
+	var best *Retailer
+	bestSimilarity := 0.0
+	for _, retailer := range catalog {
+		for _, candidate := range append([]string{retailer.Name}, retailer.Aliases...) {
+			candidateKey := receipt.NormalizeRetailer(candidate)
+			if candidateKey == key {
+				return retailer
+			}
+			if len(key) < minimumFuzzyLength || len(candidateKey) < minimumFuzzyLength {
+				continue
+			}
+			if s := similarity(key, candidateKey); s >= retailerSimilarity && s > bestSimilarity {
+				best, bestSimilarity = retailer, s
+			}
+		}
+	}
+
+	return best
+}
+
+/**
+* Returns how similar two strings are, from 0 to 1, as one less their edit distance
+* relative to the longer of them.
+ */
+func similarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	// Levenshtein distance, keeping one row of the table at a time.
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		previous := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			substitution := previous
+			if ra[i-1] != rb[j-1] {
+				substitution++
+			}
+			insertion, deletion := row[j-1]+1, row[j]+1
+			previous = row[j]
+			row[j] = substitution
+			if insertion < row[j] {
+				row[j] = insertion
+			}
+			if deletion < row[j] {
+				row[j] = deletion
+			}
+		}
+	}
+
+	return 1 - float64(row[len(rb)])/float64(longest)
+}
+
+/**
+* Builds the response for a retailer, counting the receipts matched to it.
+ */
+func retailerResponse(store Store, retailer *Retailer) (RetailerResponse, error) {
+	receipts, err := store.GetRetailerReceipts(retailer.Id)
+	if err != nil {
+		return RetailerResponse{}, err
+	}
+
+	aliases := retailer.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+
+	return RetailerResponse{retailer.Id, retailer.Name, aliases, len(receipts)}, nil
+}
+
+/**
+* Handler for POST on the /retailers path. Adds a retailer to the catalog, unless one of
+* its names is already a name of another retailer or two of its names are the same.
+* Receipts processed before are not matched to it.
+ */
+func createRetailerHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	var retailerRequest RetailerRequest
+	if err := json.Unmarshal(body, &retailerRequest); err != nil {
+		respond(http.StatusBadRequest, InvalidRetailerResponse, res)
+		return
+	}
+
+	keys := map[string]bool{}
+	for _, name := range append([]string{retailerRequest.Name}, retailerRequest.Aliases...) {
+		key := receipt.NormalizeRetailer(name)
+		if key == "" {
+			respond(http.StatusBadRequest, InvalidRetailerResponse, res)
+			return
+		}
+		if keys[key] {
+			respond(http.StatusBadRequest, DuplicateRetailerResponse, res)
+			return
+		}
+		keys[key] = true
+	}
+
+	retailer := &Retailer{Id: uuid.New().String(), Name: retailerRequest.Name, Aliases: retailerRequest.Aliases}
+	if err := store.InsertRetailer(retailer); err != nil {
+		if errors.Is(err, ErrRetailerExists) {
+			respond(http.StatusConflict, RetailerExistsResponse, res)
+			return
+		}
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	response, err := retailerResponse(store, retailer)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(response, res)
+}
+
+/**
+* Handler for GET on the /retailers path. Lists the catalog, with how many receipts are
+* matched to each retailer.
+ */
+func retailersHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	catalog, err := store.GetRetailers()
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	retailersResponse := RetailersResponse{Retailers: make([]RetailerResponse, len(catalog))}
+	for i, retailer := range catalog {
+		retailersResponse.Retailers[i], err = retailerResponse(store, retailer)
+		if err != nil {
+			respond(http.StatusInternalServerError, ServerErrorResponse, res)
+			return
+		}
+	}
+
+	respondJSON(retailersResponse, res)
+}
+
+/**
+* Handler for the /retailers/{id}/merge path. Merges the retailers in the request into
+* the one in the path: their names become its aliases, and their receipts are matched to
+* it instead. The request must not list the retailer in the path, or any retailer twice.
+ */
+func mergeRetailersHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	retailerId, ok := pathId(req)
+	if !ok {
+		respond(http.StatusNotFound, RetailerNotFoundResponse, res)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	var mergeRequest MergeRequest
+	if err := json.Unmarshal(body, &mergeRequest); err != nil || len(mergeRequest.RetailerIds) == 0 {
+		respond(http.StatusBadRequest, InvalidMergeResponse, res)
+		return
+	}
+
+	listed := map[string]bool{retailerId: true}
+	for _, id := range mergeRequest.RetailerIds {
+		if _, err := uuid.Parse(id); err != nil {
+			respond(http.StatusNotFound, RetailerNotFoundResponse, res)
+			return
+		}
+		if listed[id] {
+			respond(http.StatusBadRequest, InvalidMergeResponse, res)
+			return
+		}
+		listed[id] = true
+	}
+
+	merged, err := store.MergeRetailers(retailerId, mergeRequest.RetailerIds)
+	if errors.Is(err, ErrNotFound) {
+		respond(http.StatusNotFound, RetailerNotFoundResponse, res)
+		return
+	} else if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	response, err := retailerResponse(store, merged)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(response, res)
+}
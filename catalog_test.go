@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+)
+
+func TestMatchRetailer_Normalizes(t *testing.T) {
+	catalog := []*Retailer{
+		{Id: "mm", Name: "M&M Corner Market"},
+		{Id: "target", Name: "Target"},
+		{Id: "cvs", Name: "CVS"},
+		{Id: "walgreens", Name: "Walgreens", Aliases: []string{"Walgreens Pharmacy"}},
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"M & M CORNER MKT", "mm"},
+		{"m&m corner market", "mm"},
+		{"M and M Corner Mkt.", "mm"},
+		{"TARGET", "target"},
+		{"Targit", "target"},
+		{"CVX", ""}, // Too short to match loosely.
+		{"C.V.S.", "cvs"},
+		{"Walgreen Pharmacy", "walgreens"},
+		{"Walgrens", "walgreens"},
+		{"Costco", ""},
+		{"&", ""},
+	}
+
+	for _, test := range tests {
+		got := ""
+		if retailer := matchRetailer(catalog, test.name); retailer != nil {
+			got = retailer.Id
+		}
+		if got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestRetailers_AddedAndMerged(t *testing.T) {
+	testStore := newMemStore()
+	addRetailer := func(body string) (*http.Response, RetailerResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/retailers", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		createRetailerHandler(testStore, w, req)
+		data, _ := ioutil.ReadAll(w.Result().Body)
+		var retailerResponse RetailerResponse
+		json.Unmarshal(data, &retailerResponse)
+		return w.Result(), retailerResponse
+	}
+
+	_, market := addRetailer(`{"name": "M&M Corner Market"}`)
+	_, mkt := addRetailer(`{"name": "MM Corner Shop"}`)
+	if res, _ := addRetailer(`{"name": "M & M CORNER MKT"}`); res.StatusCode != 409 {
+		t.Error("A name already in the catalog should be refused")
+	}
+
+	for _, retailer := range []string{"M & M Corner Mkt", "MM CORNER SHOP", "Target"} {
+		stored := &StoredReceipt{
+			Id:          uuid.New().String(),
+			Receipt:     receipt.Receipt{Retailer: retailer},
+			ProcessedAt: time.Now().UTC(),
+		}
+		catalog, _ := testStore.GetRetailers()
+		if match := matchRetailer(catalog, retailer); match != nil {
+			stored.RetailerId = match.Id
+		}
+		testStore.InsertReceipt(stored)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/retailers/"+market.Id+"/merge", strings.NewReader(`{"retailerIds": ["`+mkt.Id+`"]}`))
+	w := httptest.NewRecorder()
+	mergeRetailersHandler(testStore, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var merged RetailerResponse
+	json.Unmarshal(data, &merged)
+	if merged.Receipts != 2 || len(merged.Aliases) != 1 || merged.Aliases[0] != "MM Corner Shop" {
+		t.Errorf("Invalid merge: %s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/retailers", nil)
+	w = httptest.NewRecorder()
+	retailersHandler(testStore, w, req)
+	data, _ = ioutil.ReadAll(w.Result().Body)
+	var retailersResponse RetailersResponse
+	json.Unmarshal(data, &retailersResponse)
+	if len(retailersResponse.Retailers) != 1 {
+		t.Errorf("Merged retailer is still listed: %s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/retailers/"+mkt.Id+"/merge", strings.NewReader(`{"retailerIds": ["`+market.Id+`"]}`))
+	w = httptest.NewRecorder()
+	mergeRetailersHandler(testStore, w, req)
+	if w.Result().StatusCode != 404 {
+		t.Error("Merging into a removed retailer should not be found")
+	}
+}
+
+func TestRetailers_RefusesInvalidRequests(t *testing.T) {
+	testStore := newMemStore()
+	post := func(handler func(Store, http.ResponseWriter, *http.Request), path string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler(testStore, w, req)
+		return w.Result().StatusCode
+	}
+
+	if code := post(createRetailerHandler, "/retailers", `{"name": "M&M Corner Market", "aliases": ["M & M Corner Mkt"]}`); code != 400 {
+		t.Errorf("Expected 400 for an alias that is the same as the name, got %d", code)
+	}
+
+	market := &Retailer{Id: uuid.New().String(), Name: "M&M Corner Market"}
+	shop := &Retailer{Id: uuid.New().String(), Name: "MM Corner Shop"}
+	testStore.InsertRetailer(market)
+	testStore.InsertRetailer(shop)
+
+	tests := []struct {
+		name string
+		ids  string
+		code int
+	}{
+		{"invalid id", `["not-a-uuid"]`, 404},
+		{"itself", `["` + market.Id + `"]`, 400},
+		{"twice", `["` + shop.Id + `", "` + shop.Id + `"]`, 400},
+	}
+	for _, test := range tests {
+		if code := post(mergeRetailersHandler, "/retailers/"+market.Id+"/merge", `{"retailerIds": `+test.ids+`}`); code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, code)
+		}
+	}
+
+	if retailer, err := testStore.GetRetailer(shop.Id); err != nil || retailer.Name != "MM Corner Shop" {
+		t.Error("A refused merge changed the catalog")
+	}
+}
+
+func TestCreateRetailerHandler_RefusesConcurrentNames(t *testing.T) {
+	testStore := newMemStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"name": "M&M Corner Market"}`
+			if i%2 == 1 {
+				body = `{"name": "Target", "aliases": ["M & M CORNER MKT"]}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/retailers", strings.NewReader(body))
+			createRetailerHandler(testStore, httptest.NewRecorder(), req)
+		}(i)
+	}
+	wg.Wait()
+
+	if catalog, _ := testStore.GetRetailers(); len(catalog) != 1 {
+		t.Errorf("Expected one retailer to take the name, got %d", len(catalog))
+	}
+	if err := testStore.InsertRetailer(&Retailer{Id: uuid.New().String(), Name: "m & m corner market"}); err != ErrRetailerExists {
+		t.Errorf("Expected ErrRetailerExists, got %v", err)
+	}
+}
+
+func TestProcessHandler_StoresCanonicalRetailer(t *testing.T) {
+	testStore := newMemStore()
+	testStore.InsertRetailer(&Retailer{Id: uuid.New().String(), Name: "M&M Corner Market"})
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "M & M CORNER MKT",
+		"purchaseDate": "2022-03-20",
+		"purchaseTime": "14:33",
+		"items": [{ "shortDescription": "Gatorade", "price": "2.25" }],
+		"total": "2.25"
+	  }`))
+	w := httptest.NewRecorder()
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id, nil)
+	w = httptest.NewRecorder()
+	receiptHandler(testStore, w, req)
+	data, _ = ioutil.ReadAll(w.Result().Body)
+	var receiptResponse ReceiptResponse
+	json.Unmarshal(data, &receiptResponse)
+	if receiptResponse.Retailer != "M & M CORNER MKT" || receiptResponse.CanonicalRetailer != "M&M Corner Market" {
+		t.Errorf("Invalid retailers: %s", data)
+	}
+}
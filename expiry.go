@@ -0,0 +1,197 @@
+/**
+* This file contains the expiry of points. A receipt's credit expires a configured number
+* of months after its purchase date, and a background sweeper posts expiry entries to
+* the ledger for whatever of it is still unspent.
+ */
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Models a response to the accounts/{id}/expiring endpoint.
+type ExpiringResponse struct {
+	AccountId string           `json:"accountId"`
+	Points    int64            `json:"points"`
+	Credits   []ExpiringCredit `json:"credits"`
+}
+
+type ExpiringCredit struct {
+	CreditId  string    `json:"creditId"`
+	ReceiptId string    `json:"receiptId,omitempty"`
+	Points    int64     `json:"points"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// How far ahead the expiring endpoint looks if the request doesn't say.
+const defaultExpiringWithin = 30 * 24 * time.Hour
+
+// A credit and how many of its points are still unspent.
+type unspentCredit struct {
+	entry   *LedgerEntry
+	unspent int64
+}
+
+/**
+* Returns when the points of a receipt purchased on the date expire, or zero if months is
+* zero. The date has already been validated by the receipt package.
+ */
+func pointsExpiry(purchaseDate string, months int) time.Time {
+	if months == 0 {
+		return time.Time{}
+	}
+
+	date, err := time.Parse("2006-01-02", purchaseDate)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return date.AddDate(0, months, 0)
+}
+
+/**
+* Works out how many points of each positive entry of a ledger are still unspent,
+* ordered by when they expire. Debits and negative adjustments use up the points that
+* expire soonest first, and an expiry uses up the rest of its own credit. Entries that
+* never expire come last.
+ */
+func unspentCredits(entries []*LedgerEntry) []*unspentCredit {
+	var credits []*unspentCredit
+	byId := map[string]*unspentCredit{}
+	for _, entry := range entries {
+		if entry.Points > 0 {
+			credit := &unspentCredit{entry, entry.Points}
+			credits = append(credits, credit)
+			byId[entry.Id] = credit
+		}
+	}
+
+	var spent int64 = 0
+	for _, entry := range entries {
+		if entry.Kind == LedgerExpiry {
+			if credit, found := byId[entry.CreditId]; found {
+				credit.unspent += entry.Points
+			}
+		} else if entry.Points < 0 {
+			spent -= entry.Points
+		}
+	}
+
+	sort.SliceStable(credits, func(i, j int) bool {
+		a, b := credits[i].entry.ExpiresAt, credits[j].entry.ExpiresAt
+		return !a.IsZero() && (b.IsZero() || a.Before(b))
+	})
+
+	for _, credit := range credits {
+		used := credit.unspent
+		if spent < used {
+			used = spent
+		}
+		credit.unspent -= used
+		spent -= used
+	}
+
+	return credits
+}
+
+/**
+* Builds the expiry entries for the credits of a ledger that expired by now and still
+* have unspent points. An expiry never takes the balance below zero.
+ */
+func expiredCredits(entries []*LedgerEntry, now time.Time) []*LedgerEntry {
+	remaining := balance(entries)
+
+	var expiries []*LedgerEntry
+	for _, credit := range unspentCredits(entries) {
+		expiresAt := credit.entry.ExpiresAt
+		if expiresAt.IsZero() || expiresAt.After(now) {
+			continue
+		}
+
+		points := credit.unspent
+		if remaining < points {
+			points = remaining
+		}
+		if points <= 0 {
+			continue
+		}
+		remaining -= points
+
+		expiry := newLedgerEntry(credit.entry.AccountId, LedgerExpiry, -points, "points expired")
+		expiry.ReceiptId = credit.entry.ReceiptId
+		expiry.CreditId = credit.entry.Id
+		expiry.CreatedAt = now.UTC()
+		expiries = append(expiries, expiry)
+	}
+
+	return expiries
+}
+
+/**
+* Expires points every interval until the process exits, starting straight away.
+ */
+func sweepExpiredPoints(store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expiries, err := store.ExpireCredits(time.Now())
+		if err != nil {
+			log.Println("Sweeping expired points:", err)
+		} else if len(expiries) > 0 {
+			log.Printf("Expired points of %d credits", len(expiries))
+		}
+		<-ticker.C
+	}
+}
+
+/**
+* Handler for the /accounts/{id}/expiring path. Lists the account's unspent points that
+* expire within the duration in the within query parameter (30 days by default).
+ */
+func expiringHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return
+	}
+
+	within := defaultExpiringWithin
+	if param := req.URL.Query().Get("within"); param != "" {
+		var err error
+		within, err = time.ParseDuration(param)
+		if err != nil || within < 0 {
+			respond(http.StatusBadRequest, InvalidWithinResponse, res)
+			return
+		}
+	}
+
+	entries, err := store.GetLedger(account.Id)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	horizon := time.Now().Add(within)
+	expiringResponse := ExpiringResponse{AccountId: account.Id, Credits: []ExpiringCredit{}}
+	for _, credit := range unspentCredits(entries) {
+		expiresAt := credit.entry.ExpiresAt
+		if expiresAt.IsZero() || expiresAt.After(horizon) || credit.unspent <= 0 {
+			continue
+		}
+
+		expiringResponse.Points += credit.unspent
+		expiringResponse.Credits = append(expiringResponse.Credits, ExpiringCredit{
+			CreditId:  credit.entry.Id,
+			ReceiptId: credit.entry.ReceiptId,
+			Points:    credit.unspent,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	respondJSON(expiringResponse, res)
+}
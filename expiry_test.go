@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func processExpiring(store Store, accountId string, date string) {
+	config := defaultConfig
+	config.PointsExpireMonths = 12
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", receiptForAccount(accountId, date))
+	w := httptest.NewRecorder()
+	processHandler(store, testRulebook, config, w, req)
+}
+
+func TestExpiry_ExpiresUnspentPoints(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	processExpiring(testStore, accountId, "2022-03-21")   // 81 points, expiring 2023-03-21
+	processExpiring(testStore, accountId, "2022-06-20")   // 75 points, expiring 2023-06-20
+	processForAccount(testStore, accountId, "2022-07-20") // 75 points that never expire
+
+	// The redemption uses up the points that expire first.
+	postLedgerRequest(redemptionHandler, testStore, "/accounts/"+accountId+"/redemptions", `{"points": 50, "reason": "gift card"}`)
+
+	expiries, err := testStore.ExpireCredits(time.Date(2023, 3, 21, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiries) != 1 || expiries[0].Points != -31 || expiries[0].CreditId == "" {
+		t.Fatalf("Invalid expiries: %+v", expiries)
+	}
+	if getBalance(testStore, accountId) != 150 {
+		t.Error("Expired points are still in the balance")
+	}
+
+	// Sweeping again expires nothing new.
+	expiries, _ = testStore.ExpireCredits(time.Date(2023, 3, 22, 0, 0, 0, 0, time.UTC))
+	if len(expiries) != 0 {
+		t.Errorf("Points expired twice: %+v", expiries)
+	}
+
+	expiries, _ = testStore.ExpireCredits(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(expiries) != 1 || expiries[0].Points != -75 || getBalance(testStore, accountId) != 75 {
+		t.Errorf("Invalid expiries: %+v", expiries)
+	}
+}
+
+func TestExpiry_NeverTakesBalanceNegative(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	processExpiring(testStore, accountId, "2022-03-21") // 81 points
+	postLedgerRequest(adjustmentHandler, testStore, "/accounts/"+accountId+"/adjustments", `{"points": -100, "reason": "fraud"}`)
+
+	expiries, _ := testStore.ExpireCredits(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(expiries) != 0 || getBalance(testStore, accountId) != -19 {
+		t.Errorf("Invalid expiries: %+v", expiries)
+	}
+}
+
+func TestExpiry_ListsExpiringCredits(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	processForAccount(testStore, accountId, "2022-03-21")
+	processExpiring(testStore, accountId, "2022-03-20") // Expired a while ago, but not swept.
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/expiring", nil)
+	w := httptest.NewRecorder()
+	expiringHandler(testStore, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var expiringResponse ExpiringResponse
+	json.Unmarshal(data, &expiringResponse)
+	if expiringResponse.Points != 75 || len(expiringResponse.Credits) != 1 || expiringResponse.Credits[0].ReceiptId == "" {
+		t.Errorf("Invalid expiring response: %s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/expiring?within=soon", nil)
+	w = httptest.NewRecorder()
+	expiringHandler(testStore, w, req)
+	if w.Result().StatusCode != 400 {
+		t.Error("Invalid duration should be refused")
+	}
+}
@@ -0,0 +1,173 @@
+/**
+* This file contains the on-disk store. It keeps the same in-memory DB as memStore for
+* reads, and additionally appends every committed change to a log file. On startup the
+* log is replayed into the DB, so the data survives process restarts.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+// One line of the log file.
+type journalRecord struct {
+	Table   string          `json:"table"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Object  json.RawMessage `json:"object"`
+}
+
+// The parts of *os.File that the log needs.
+type logFile interface {
+	io.ReadWriteCloser
+	Seek(offset int64, whence int) (int64, error)
+	Truncate(size int64) error
+	Sync() error
+}
+
+// A Store that persists its contents to an append-only log file.
+type fileStore struct {
+	*memStore
+	file logFile
+}
+
+/**
+* Opens the log file at path, creating it if it doesn't exist, and replays it into a
+* fresh in-memory DB.
+ */
+func openFileStore(path string) (*fileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &fileStore{memStore: newMemStore(), file: file}
+	if err := store.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replaying %s: %w", path, err)
+	}
+	store.journal = store.append
+
+	return store, nil
+}
+
+/**
+* Reads every record in the log and applies it to the DB. A final line without a
+* newline is left over from a write that was interrupted, so it is cut off rather than
+* treated as an error.
+ */
+func (s *fileStore) replay() error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	reader := bufio.NewReader(s.file)
+	var offset int64 = 0
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := s.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		newObject, ok := tableTypes[record.Table]
+		if !ok {
+			return fmt.Errorf("line %d: unknown table %q", lineNumber, record.Table)
+		}
+		object := newObject()
+		if err := json.Unmarshal(record.Object, object); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		if record.Deleted {
+			err = txn.Delete(record.Table, object)
+		} else {
+			err = txn.Insert(record.Table, object)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		offset += int64(len(line))
+	}
+
+	txn.Commit()
+	return nil
+}
+
+/**
+* Writes the changes of a transaction to the end of the log and syncs the file, so a
+* transaction is only committed once it is on disk. If the write or the sync fails, the
+* log is cut back to where it ended before, so a partly written record is not left
+* behind for the next replay to trip over.
+ */
+func (s *fileStore) append(changes memdb.Changes) error {
+	var lines []byte
+	for _, change := range changes {
+		record := journalRecord{Table: change.Table}
+		object := change.After
+		if change.Deleted() {
+			record.Deleted = true
+			object = change.Before
+		}
+
+		data, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		record.Object = data
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	offset, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(lines); err != nil {
+		return s.rollback(offset, err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return s.rollback(offset, err)
+	}
+
+	return nil
+}
+
+/**
+* Truncates the log to offset after a failed append and returns the error that caused
+* it, along with the truncation's error if that failed too.
+ */
+func (s *fileStore) rollback(offset int64, cause error) error {
+	if err := s.file.Truncate(offset); err != nil {
+		return fmt.Errorf("%w (truncating the log: %v)", cause, err)
+	}
+
+	return cause
+}
+
+func (s *fileStore) Close() error {
+	return s.file.Close()
+}
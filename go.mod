@@ -3,10 +3,13 @@ module danielHett/main
 go 1.20
 
 require (
-	github.com/go-chi/chi/v5 v5.0.8 // indirect
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/go-chi/chi/v5 v5.0.8
+	github.com/google/uuid v1.3.0
+	github.com/hashicorp/go-memdb v1.3.4
+)
+
+require (
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/hashicorp/go-immutable-radix v1.3.0 // indirect
-	github.com/hashicorp/go-memdb v1.3.4 // indirect
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 )
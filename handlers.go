@@ -1,96 +1,277 @@
 /**
-* This file contains the handlers for the two server endpoints. All helper code is
-* defined seperately in the utils.go file.
+* This file contains the handlers for the server endpoints. Scoring lives in the
+* receipt package and all other helper code is defined seperately in the utils.go file.
  */
 
 package main
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"mime"
 	"net/http"
-	"strings"
+	"time"
 
-	"github.com/google/uuid"
-	"github.com/hashicorp/go-memdb"
+	"danielHett/main/receipt"
 )
 
-// Key-Value pair that is stored in the DB.
+// Everything that is stored for a processed receipt.
 type StoredReceipt struct {
-	Id     string
-	Points int64
-}
+	Id          string
+	Points      int64
+	Rules       []receipt.RuleResult
+	Flags       []*receipt.ValidationError
+	RuleSet     string
+	Receipt     receipt.Receipt
+	ProcessedAt time.Time
+	Fingerprint string
 
-// Below two model incoming requests to the receipts/process endpoint. It represents a receipt.
-type ProcessRequest struct {
-	Retailer     *string
-	PurchaseDate *string
-	PurchaseTime *string
-	Items        *[]Item
-	Total        *string
+	// When the receipt was purchased, in UTC.
+	PurchasedAt time.Time
+
+	// The id of the receipt with the same fingerprint, if this one was accepted as a
+	// duplicate of it.
+	DuplicateOf string
+
+	// The loyalty account the receipt earns points for, if any, and when those points
+	// expire. ExpiresAt is zero if they never do.
+	AccountId string
+	ExpiresAt time.Time
+
+	// The tier of the account when the receipt was scored, if the rules have tiers.
+	Tier *receipt.TierConfig
+
+	// The catalog entry that the retailer on the receipt matched, if any.
+	RetailerId string
+
+	// The id of the receipt that a return or exchange took points back from, if any.
+	ReturnOf string
+
+	// The currency of the amounts on the receipt: the one it names, or that of the rules it
+	// was scored with if it names none.
+	Currency string
 }
 
-type Item struct {
-	ShortDescription *string
-	Price            *string
+// Models a request to the receipts/process endpoint: a receipt, and optionally the
+// account that it earns points for.
+type ProcessRequest struct {
+	receipt.Receipt
+	AccountId string `json:"accountId,omitempty"`
 }
 
 // Models a response to the receipts/process endpoint.
 type ProcessResponse struct {
-	Id string `json:"id"`
+	Id    string                     `json:"id"`
+	Flags []*receipt.ValidationError `json:"flags,omitempty"`
 }
 
 // Models a response to the receipts/{id}/points endpoint.
 type PointsResponse struct {
-	Points int64 `json:"points"`
+	Points  int64  `json:"points"`
+	RuleSet string `json:"ruleSet"`
+}
+
+// Models a response to the receipts/process:batch endpoint. There is one result per
+// receipt in the request, with either an id or an error.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+type BatchResult struct {
+	Index int                        `json:"index"`
+	Id    string                     `json:"id,omitempty"`
+	Flags []*receipt.ValidationError `json:"flags,omitempty"`
+	Error *Problem                   `json:"error,omitempty"`
+}
+
+// Models a response to the receipts/{id} endpoint. It is the receipt as it was submitted,
+// when it was purchased in UTC, and the catalog entry its retailer matched.
+type ReceiptResponse struct {
+	Id string `json:"id"`
+	receipt.Receipt
+	PurchaseInstant   time.Time                  `json:"purchaseInstant"`
+	ProcessedAt       time.Time                  `json:"processedAt"`
+	Flags             []*receipt.ValidationError `json:"flags,omitempty"`
+	RetailerId        string                     `json:"retailerId,omitempty"`
+	CanonicalRetailer string                     `json:"canonicalRetailer,omitempty"`
+}
+
+// Models a response to the receipts/{id}/points/breakdown endpoint.
+type BreakdownResponse struct {
+	Points  int64                      `json:"points"`
+	RuleSet string                     `json:"ruleSet"`
+	Rules   []receipt.RuleResult       `json:"rules"`
+	Flags   []*receipt.ValidationError `json:"flags,omitempty"`
+}
+
+// Models an error response, as described by RFC 7807. Errors is only set when a receipt
+// fails validation, and lists every invalid field.
+type Problem struct {
+	Type   string                     `json:"type"`
+	Title  string                     `json:"title"`
+	Status int                        `json:"status"`
+	Detail string                     `json:"detail,omitempty"`
+	Errors []*receipt.ValidationError `json:"errors,omitempty"`
+
+	// The original receipt, when a duplicate is refused.
+	ReceiptId string `json:"receiptId,omitempty"`
 }
 
+// Titles of the error responses.
 const (
-	InvalidBodyResponse     = "The receipt is invalid"
-	ReceiptNotFoundResponse = "No receipt found for that id"
-	ServerErrorResponse     = "Server error"
+	InvalidBodyResponse          = "The receipt is invalid"
+	InvalidBatchResponse         = "The batch must be a JSON array of receipts"
+	ReceiptNotFoundResponse      = "No receipt found for that id"
+	UnknownRuleSetResponse       = "No rule set found for that version"
+	IdempotencyKeyReusedResponse = "The idempotency key was already used for a different receipt"
+	DuplicateReceiptResponse     = "The receipt was already submitted"
+	AccountNotFoundResponse      = "No account found for that id"
+	InvalidAccountResponse       = "The account is invalid"
+	InvalidLedgerRequestResponse = "The ledger request is invalid"
+	InvalidRedemptionResponse    = "A redemption must be for a positive number of points"
+	InvalidAdjustmentResponse    = "An adjustment must change the points and have a reason"
+	InsufficientPointsResponse   = "The account does not have enough points"
+	InvalidWithinResponse        = "The within parameter must be a duration like 720h"
+	NoTiersResponse              = "The rules have no tiers"
+	CampaignNotFoundResponse     = "No campaign found for that id"
+	InvalidCampaignResponse      = "The campaign is invalid"
+	RetailerNotFoundResponse     = "No retailer found for that id"
+	InvalidRetailerResponse      = "The retailer must have a name"
+	RetailerExistsResponse       = "A retailer with that name is already in the catalog"
+	DuplicateRetailerResponse    = "The names of the retailer must all be different"
+	InvalidMergeResponse         = "The merge must list the other retailers to merge, each once"
+	UnknownLayoutResponse        = "No receipt layout found for that name"
+	ServerErrorResponse          = "Server error"
 )
 
 /**
-* Handler for the /receipt/process path.
+* Handler for the /receipt/process path. A request with an Idempotency-Key header that
+* was already used within the configured window gets the original response. A body with
+* Content-Type text/plain is the text of a printed receipt, read with the configured
+* layouts; the layout and accountId query parameters pick the layout and the account.
  */
-func processHandler(db *memdb.MemDB, res http.ResponseWriter, req *http.Request) {
+func processHandler(store Store, rulebook *receipt.Rulebook, config Config, res http.ResponseWriter, req *http.Request) {
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		respond(http.StatusBadRequest, []byte(ServerErrorResponse), res)
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	// Check whether this is a retry of a request that was already processed.
+	idempotencyKey := req.Header.Get("Idempotency-Key")
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	requestHash := hashRequest(mediaType, req.URL.Query(), body)
+	if idempotencyKey != "" {
+		record, err := store.GetIdempotencyRecord(idempotencyKey)
+		if err == nil && !record.Expired(config.IdempotencyWindow) {
+			replay(record, requestHash, res)
+			return
+		}
+	}
+
+	// Read the receipt from JSON, or from the text printed on it.
+	var processRequest ProcessRequest
+	var unparsed []*receipt.ValidationError
+	if mediaType == "text/plain" {
+		parsed, found := receipt.ParseText(string(body), config.Layouts, req.URL.Query().Get("layout"))
+		if !found {
+			respond(http.StatusBadRequest, UnknownLayoutResponse, res)
+			return
+		}
+		processRequest = ProcessRequest{Receipt: parsed.Receipt, AccountId: req.URL.Query().Get("accountId")}
+		unparsed = parsed.Unparsed
+	} else if err := json.Unmarshal(body, &processRequest); err != nil {
+		respondInvalid(err, res)
 		return
 	}
 
-	var processRequest = new(ProcessRequest)
-	err = json.Unmarshal(body, processRequest)
+	// Score the receipt under a fresh id. The lines of a text receipt that couldn't be
+	// parsed explain why it is invalid, or are flagged if it isn't.
+	stored, err := scoreReceipt(store, rulebook, config, processRequest, nil)
+	if err != nil {
+		problem := invalidProblem(err)
+		problem.Errors = append(problem.Errors, unparsed...)
+		respondProblem(problem, res)
+		return
+	}
+	stored.Flags = append(stored.Flags, unparsed...)
+
+	// Store the receipt alongside its id and points.
+	jData, existing, err := insertProcessed(store, config, stored, idempotencyKey, requestHash)
+	var duplicate *DuplicateError
+	var invalid receipt.ValidationErrors
+	if existing != nil {
+		// A concurrent request with the same key got there first.
+		replay(existing, requestHash, res)
+		return
+	} else if errors.As(err, &duplicate) {
+		respondProblem(duplicateProblem(duplicate), res)
+		return
+	} else if errors.Is(err, ErrUnknownAccount) {
+		respondProblem(unknownAccountProblem(), res)
+		return
+	} else if errors.As(err, &invalid) {
+		// Another return of the same items was stored after this one was scored.
+		respondInvalid(err, res)
+		return
+	} else if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(jData)
+}
+
+/**
+* Handler for the /receipt/process:batch path. The body is either a JSON array of
+* receipts or, with Content-Type application/x-ndjson, one receipt per line. Receipts
+* are scored concurrently and every valid one is stored in a single transaction. An
+* invalid or duplicate receipt only fails its own entry in the response, never the
+* whole batch.
+ */
+func batchHandler(store Store, rulebook *receipt.Rulebook, config Config, res http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		respond(http.StatusBadRequest, []byte(InvalidBodyResponse), res)
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
 		return
 	}
 
-	// Create a random id for the receipt, get the points from the body.
-	receiptID := uuid.New().String()
-	receiptPoints, isErr := calculatePoints(processRequest)
-	if isErr {
-		respond(400, []byte(InvalidBodyResponse), res)
+	var rawReceipts []json.RawMessage
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/x-ndjson" {
+		rawReceipts = splitLines(body)
+	} else if err := json.Unmarshal(body, &rawReceipts); err != nil {
+		respond(http.StatusBadRequest, InvalidBatchResponse, res)
 		return
 	}
 
-	// Set up a transaction and store the id, points as a key-val pair in the DB.
-	txn := db.Txn(true)
-	err = txn.Insert("receipt", &StoredReceipt{receiptID, receiptPoints})
+	stored, problems := scoreBatch(store, rulebook, config, rawReceipts)
+
+	// Store every receipt that was scored, all at once.
+	err = insertBatch(store, config, stored, problems)
 	if err != nil {
-		respond(http.StatusBadRequest, []byte(ServerErrorResponse), res)
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
 		return
 	}
-	txn.Commit()
 
-	// Send the id back to the client.
-	var processReponse ProcessResponse
-	processReponse.Id = receiptID
-	jData, err := json.Marshal(processReponse)
+	// Report an id or the problem for each receipt, in the order they were sent.
+	batchResponse := BatchResponse{Results: make([]BatchResult, len(rawReceipts))}
+	for i := range rawReceipts {
+		batchResponse.Results[i].Index = i
+		if stored[i] != nil {
+			batchResponse.Results[i].Id = stored[i].Id
+			batchResponse.Results[i].Flags = stored[i].Flags
+		} else {
+			batchResponse.Results[i].Error = problems[i]
+		}
+	}
+
+	jData, err := json.Marshal(batchResponse)
 	if err != nil {
-		respond(http.StatusBadRequest, []byte(ServerErrorResponse), res)
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
 		return
 	}
 
@@ -100,34 +281,86 @@ func processHandler(db *memdb.MemDB, res http.ResponseWriter, req *http.Request)
 }
 
 /**
-* Handler for the /receipt/{id}/points path.
+* Handler for the /receipt/{id} path.
  */
-func pointsHandler(db *memdb.MemDB, res http.ResponseWriter, req *http.Request) {
-	// Get the id from the path.
-	urlParts := strings.Split(req.URL.String(), "/")
-	receiptId := urlParts[2]
-	_, err := uuid.Parse(receiptId)
+func receiptHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	stored, found := findReceipt(store, req)
+	if !found {
+		respond(http.StatusNotFound, ReceiptNotFoundResponse, res)
+		return
+	}
+
+	// Put the submitted receipt in a response.
+	receiptResponse := ReceiptResponse{Id: stored.Id, Receipt: stored.Receipt, PurchaseInstant: stored.PurchasedAt, ProcessedAt: stored.ProcessedAt, Flags: stored.Flags}
+	if retailer, err := store.GetRetailer(stored.RetailerId); err == nil {
+		receiptResponse.RetailerId = retailer.Id
+		receiptResponse.CanonicalRetailer = retailer.Name
+	}
+	jData, err := json.Marshal(receiptResponse)
 	if err != nil {
-		// There wasn't a valid uuid.
-		respond(http.StatusNotFound, []byte(ReceiptNotFoundResponse), res)
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	// Send response to the client.
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(jData)
+}
+
+/**
+* Handler for the /receipt/{id}/points path. The ruleset query parameter re-scores the
+* receipt under another version of the rules.
+ */
+func pointsHandler(store Store, rulebook *receipt.Rulebook, res http.ResponseWriter, req *http.Request) {
+	stored, found := findReceipt(store, req)
+	if !found {
+		respond(http.StatusNotFound, ReceiptNotFoundResponse, res)
 		return
 	}
 
-	// Try retrieving the points from the db.
-	txn := db.Txn(false)
-	raw, err := txn.First("receipt", "id", receiptId)
-	if err != nil || raw == nil {
-		// Couldn't find the id.
-		respond(http.StatusNotFound, []byte(ReceiptNotFoundResponse), res)
+	result, version, err := storedResult(rulebook, stored, req.URL.Query().Get("ruleset"))
+	if err != nil {
+		respondScoreError(err, res)
 		return
 	}
 
-	// Put the retrieved points in a response.
-	var pointsResponse PointsResponse
-	pointsResponse.Points = raw.(*StoredReceipt).Points
+	// Put the points in a response.
+	pointsResponse := PointsResponse{result.Points, version}
 	jData, err := json.Marshal(pointsResponse)
 	if err != nil {
-		respond(http.StatusBadRequest, []byte(ServerErrorResponse), res)
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return
+	}
+
+	// Send response to the client.
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(jData)
+}
+
+/**
+* Handler for the /receipt/{id}/points/breakdown path. Takes the same ruleset query
+* parameter as the points path.
+ */
+func breakdownHandler(store Store, rulebook *receipt.Rulebook, res http.ResponseWriter, req *http.Request) {
+	stored, found := findReceipt(store, req)
+	if !found {
+		respond(http.StatusNotFound, ReceiptNotFoundResponse, res)
+		return
+	}
+
+	result, version, err := storedResult(rulebook, stored, req.URL.Query().Get("ruleset"))
+	if err != nil {
+		respondScoreError(err, res)
+		return
+	}
+
+	// Put the points and the rules that awarded them in a response.
+	breakdownResponse := BreakdownResponse{result.Points, version, result.Rules, result.Flags}
+	jData, err := json.Marshal(breakdownResponse)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
 		return
 	}
 
@@ -0,0 +1,61 @@
+/**
+* This file contains the support for the Idempotency-Key header on receipts/process. A
+* client that retries a request with the same key gets the original response back
+* instead of creating a second receipt.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The response sent for an idempotency key, kept so it can be sent again.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	ReceiptId   string
+	Response    []byte
+	CreatedAt   time.Time
+}
+
+// Whether the record is older than the window in which its key is honoured.
+func (r *IdempotencyRecord) Expired(window time.Duration) bool {
+	return time.Since(r.CreatedAt) > window
+}
+
+/**
+* Hashes a request, so a key reused with a different one can be told apart. A text
+* receipt names its account and layout in the query, so those are hashed along with the
+* media type and the body.
+ */
+func hashRequest(mediaType string, query url.Values, body []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{mediaType, query.Get("accountId"), query.Get("layout")} {
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+/**
+* Sends the stored response for a repeated key. If the key was first used with a
+* different body the request is refused instead, since replaying would hide that the
+* new receipt was never processed.
+ */
+func replay(record *IdempotencyRecord, requestHash string, res http.ResponseWriter) {
+	if record.RequestHash != requestHash {
+		respond(http.StatusUnprocessableEntity, IdempotencyKeyReusedResponse, res)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Idempotent-Replayed", "true")
+	res.WriteHeader(http.StatusOK)
+	res.Write(record.Response)
+}
@@ -0,0 +1,218 @@
+/**
+* This file contains the points ledger of the loyalty accounts. Every change to an
+* account's points is an entry in the ledger, and the balance is the sum of the entries.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A single change to the points of an account. Credits are positive, debits, claw backs
+// and expiries negative and adjustments either. Entries are never changed or removed once
+// inserted.
+type LedgerEntry struct {
+	Id        string
+	AccountId string
+	Kind      string
+	Points    int64
+	Reason    string
+	ReceiptId string
+	CreatedAt time.Time
+
+	// For a credit, when its points expire; zero if they never do. For an expiry, the
+	// credit whose points expired.
+	ExpiresAt time.Time
+	CreditId  string
+}
+
+// The kinds of ledger entry.
+const (
+	LedgerCredit     = "credit"
+	LedgerDebit      = "debit"
+	LedgerAdjustment = "adjustment"
+	LedgerExpiry     = "expiry"
+	LedgerClawback   = "clawback"
+)
+
+// Models a request to the accounts/{id}/redemptions and accounts/{id}/adjustments
+// endpoints. Redemptions take a positive number of points to spend; adjustments take
+// a positive or negative change.
+type LedgerRequest struct {
+	Points int64  `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// Models a response to the accounts/{id}/redemptions and accounts/{id}/adjustments
+// endpoints.
+type LedgerResponse struct {
+	EntryId string `json:"entryId"`
+	Balance int64  `json:"balance"`
+}
+
+// Models a response to the accounts/{id}/ledger endpoint.
+type LedgerListResponse struct {
+	Balance int64                 `json:"balance"`
+	Entries []LedgerEntryResponse `json:"entries"`
+}
+
+type LedgerEntryResponse struct {
+	Id        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Points    int64      `json:"points"`
+	Reason    string     `json:"reason"`
+	ReceiptId string     `json:"receiptId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreditId  string     `json:"creditId,omitempty"`
+}
+
+// Sums the points of the ledger entries.
+func balance(entries []*LedgerEntry) int64 {
+	var total int64 = 0
+	for _, entry := range entries {
+		total += entry.Points
+	}
+
+	return total
+}
+
+/**
+* Handler for the /accounts/{id}/ledger path. Lists the account's entries, oldest first.
+ */
+func ledgerHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return
+	}
+
+	entries, err := store.GetLedger(account.Id)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	listResponse := LedgerListResponse{Balance: balance(entries), Entries: make([]LedgerEntryResponse, len(entries))}
+	for i, entry := range entries {
+		listResponse.Entries[i] = LedgerEntryResponse{
+			Id:        entry.Id,
+			Kind:      entry.Kind,
+			Points:    entry.Points,
+			Reason:    entry.Reason,
+			ReceiptId: entry.ReceiptId,
+			CreatedAt: entry.CreatedAt,
+			CreditId:  entry.CreditId,
+		}
+		if !entry.ExpiresAt.IsZero() {
+			listResponse.Entries[i].ExpiresAt = &entry.ExpiresAt
+		}
+	}
+
+	respondJSON(listResponse, res)
+}
+
+/**
+* Handler for the /accounts/{id}/redemptions path. Spends points from the account,
+* refusing with a 409 if the account doesn't have enough.
+ */
+func redemptionHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, ledgerRequest, ok := readLedgerRequest(store, res, req)
+	if !ok {
+		return
+	}
+	if ledgerRequest.Points <= 0 {
+		respond(http.StatusBadRequest, InvalidRedemptionResponse, res)
+		return
+	}
+
+	entry := newLedgerEntry(account.Id, LedgerDebit, -ledgerRequest.Points, ledgerRequest.Reason)
+	err := store.Redeem(entry)
+	if errors.Is(err, ErrInsufficientPoints) {
+		respond(http.StatusConflict, InsufficientPointsResponse, res)
+		return
+	} else if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondLedgerEntry(store, entry, res)
+}
+
+/**
+* Handler for the /accounts/{id}/adjustments path. Manually changes the account's
+* points. A reason is required, and unlike a redemption an adjustment may take the
+* balance below zero, e.g. to claw back points that were awarded by mistake.
+ */
+func adjustmentHandler(store Store, res http.ResponseWriter, req *http.Request) {
+	account, ledgerRequest, ok := readLedgerRequest(store, res, req)
+	if !ok {
+		return
+	}
+	if ledgerRequest.Points == 0 || ledgerRequest.Reason == "" {
+		respond(http.StatusBadRequest, InvalidAdjustmentResponse, res)
+		return
+	}
+
+	entry := newLedgerEntry(account.Id, LedgerAdjustment, ledgerRequest.Points, ledgerRequest.Reason)
+	if err := store.InsertLedgerEntry(entry); err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondLedgerEntry(store, entry, res)
+}
+
+/**
+* Looks up the account in the path and reads the body of a redemption or adjustment. If
+* either fails the error has already been sent and the last return value is false.
+ */
+func readLedgerRequest(store Store, res http.ResponseWriter, req *http.Request) (*Account, LedgerRequest, bool) {
+	var ledgerRequest LedgerRequest
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return nil, ledgerRequest, false
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		respond(http.StatusBadRequest, ServerErrorResponse, res)
+		return nil, ledgerRequest, false
+	}
+	if err := json.Unmarshal(body, &ledgerRequest); err != nil {
+		respondProblem(Problem{Type: "about:blank", Title: InvalidLedgerRequestResponse, Status: http.StatusBadRequest, Detail: err.Error()}, res)
+		return nil, ledgerRequest, false
+	}
+
+	return account, ledgerRequest, true
+}
+
+func newLedgerEntry(accountId string, kind string, points int64, reason string) *LedgerEntry {
+	return &LedgerEntry{
+		Id:        uuid.New().String(),
+		AccountId: accountId,
+		Kind:      kind,
+		Points:    points,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Sends the id of a new entry back to the client, with the balance it left.
+func respondLedgerEntry(store Store, entry *LedgerEntry, res http.ResponseWriter) {
+	entries, err := store.GetLedger(entry.AccountId)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+
+	respondJSON(LedgerResponse{entry.Id, balance(entries)}, res)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func postLedgerRequest(handler func(Store, http.ResponseWriter, *http.Request), store Store, path string, body string) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(store, w, req)
+	return w.Result()
+}
+
+func getBalance(store Store, accountId string) int64 {
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/balance", nil)
+	w := httptest.NewRecorder()
+	balanceHandler(store, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var balanceResponse BalanceResponse
+	json.Unmarshal(data, &balanceResponse)
+	return balanceResponse.Points
+}
+
+func TestLedger_RedeemsAndAdjusts(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	processForAccount(testStore, accountId, "2022-03-21") // 81 points
+
+	res := postLedgerRequest(redemptionHandler, testStore, "/accounts/"+accountId+"/redemptions", `{"points": 50, "reason": "gift card"}`)
+	if res.StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	var ledgerResponse LedgerResponse
+	json.Unmarshal(data, &ledgerResponse)
+	if ledgerResponse.Balance != 31 || ledgerResponse.EntryId == "" {
+		t.Errorf("Invalid redemption response: %s", data)
+	}
+
+	res = postLedgerRequest(redemptionHandler, testStore, "/accounts/"+accountId+"/redemptions", `{"points": 32, "reason": "gift card"}`)
+	if res.StatusCode != 409 {
+		t.Error("Overdraft should be refused")
+	}
+
+	res = postLedgerRequest(adjustmentHandler, testStore, "/accounts/"+accountId+"/adjustments", `{"points": -40}`)
+	if res.StatusCode != 400 {
+		t.Error("Adjustment without a reason should be refused")
+	}
+	res = postLedgerRequest(adjustmentHandler, testStore, "/accounts/"+accountId+"/adjustments", `{"points": -40, "reason": "fraud"}`)
+	if res.StatusCode != 200 || getBalance(testStore, accountId) != -9 {
+		t.Error("Adjustment was not applied")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/ledger", nil)
+	w := httptest.NewRecorder()
+	ledgerHandler(testStore, w, req)
+	data, _ = ioutil.ReadAll(w.Result().Body)
+	var listResponse LedgerListResponse
+	json.Unmarshal(data, &listResponse)
+	kinds := []string{LedgerCredit, LedgerDebit, LedgerAdjustment}
+	if len(listResponse.Entries) != 3 || listResponse.Balance != -9 {
+		t.Fatalf("Invalid ledger: %s", data)
+	}
+	for i, kind := range kinds {
+		if listResponse.Entries[i].Kind != kind {
+			t.Errorf("Entry %d: expected %s, got %s", i, kind, listResponse.Entries[i].Kind)
+		}
+	}
+	if listResponse.Entries[0].ReceiptId == "" {
+		t.Error("Credit does not reference its receipt")
+	}
+}
+
+func TestLedger_ConcurrentRedemptionsCannotOverdraw(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	processForAccount(testStore, accountId, "2022-03-21") // 81 points
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			postLedgerRequest(redemptionHandler, testStore, "/accounts/"+accountId+"/redemptions", `{"points": 10, "reason": "coffee"}`)
+		}()
+	}
+	wg.Wait()
+
+	if balance := getBalance(testStore, accountId); balance != 1 {
+		t.Errorf("Expected 8 redemptions to leave 1 point, got %d", balance)
+	}
+}
@@ -1,39 +1,228 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
+	"danielHett/main/receipt"
 	"github.com/go-chi/chi/v5"
 )
 
+// Settings for the handlers, set from the command line flags.
+type Config struct {
+	IdempotencyWindow time.Duration
+
+	// What happens to a receipt with the same fingerprint as a stored one: DuplicatesReject
+	// or DuplicatesFlag.
+	Duplicates string
+
+	// How many months after the purchase date the points of a receipt expire, and how
+	// often expired points are swept from the ledgers. Points never expire if zero.
+	PointsExpireMonths  int
+	ExpirySweepInterval time.Duration
+
+	// How far in the future a purchase may be, to allow for clocks that are ahead, and how
+	// long after the purchase a receipt may be submitted. Any age is allowed if zero.
+	ClockSkew        time.Duration
+	SubmissionWindow time.Duration
+
+	// The layouts that the text of printed receipts is read with.
+	Layouts []*receipt.Layout
+}
+
+const (
+	DuplicatesReject = "reject"
+	DuplicatesFlag   = "flag"
+)
+
+var defaultConfig = Config{
+	IdempotencyWindow:   24 * time.Hour,
+	Duplicates:          DuplicatesReject,
+	PointsExpireMonths:  0,
+	ExpirySweepInterval: time.Hour,
+	ClockSkew:           5 * time.Minute,
+	SubmissionWindow:    0,
+	Layouts:             receipt.DefaultLayouts,
+}
+
 func main() {
+	storeKind := flag.String("store", "memory", "Where receipts are stored: memory or file")
+	dataPath := flag.String("data", "receipts.log", "The log file used by the file store")
+	rulesPath := flag.String("rules", "", "A JSON rules file, or a directory of them; the challenge's rules are used if empty")
+	currentRuleSet := flag.String("ruleset", "", "The rule set version new receipts are scored with")
+	layoutsPath := flag.String("layouts", "", "A JSON file of layouts for reading text receipts; US and ISO layouts are used if empty")
+	ratesPath := flag.String("rates", "", "A JSON file of exchange rates into the currency of the rules; only that currency is accepted if empty")
+
+	config := defaultConfig
+	flag.DurationVar(&config.IdempotencyWindow, "idempotency-window", config.IdempotencyWindow, "How long an Idempotency-Key is remembered")
+	flag.StringVar(&config.Duplicates, "duplicates", config.Duplicates, "What to do with a receipt that was already submitted: reject or flag")
+	flag.IntVar(&config.PointsExpireMonths, "points-expire-months", config.PointsExpireMonths, "Months after the purchase date that points expire; 0 means never")
+	flag.DurationVar(&config.ExpirySweepInterval, "expiry-sweep-interval", config.ExpirySweepInterval, "How often expired points are swept")
+	flag.DurationVar(&config.ClockSkew, "clock-skew", config.ClockSkew, "How far in the future a purchase may be")
+	flag.DurationVar(&config.SubmissionWindow, "submission-window", config.SubmissionWindow, "How long after the purchase a receipt may be submitted; 0 means any time")
+	flag.Parse()
+
+	if config.PointsExpireMonths < 0 {
+		panic("The points-expire-months flag must not be negative")
+	}
+	if config.ClockSkew < 0 || config.SubmissionWindow < 0 {
+		panic("The clock-skew and submission-window flags must not be negative")
+	}
+	if config.Duplicates != DuplicatesReject && config.Duplicates != DuplicatesFlag {
+		panic("The duplicates flag must be reject or flag")
+	}
+
 	var port string
-	if len(os.Args) > 1 {
-		if convPort, err := strconv.Atoi(os.Args[1]); err != nil || convPort <= 0 {
+	if flag.NArg() > 0 {
+		if convPort, err := strconv.Atoi(flag.Arg(0)); err != nil || convPort <= 0 {
 			panic("The port argument must be a nonnegative integer")
 		}
-		port = os.Args[1]
+		port = flag.Arg(0)
 	} else {
 		port = "8080"
 	}
 
-	db := createDB()
+	ruleSets := []receipt.RuleSet{receipt.DefaultRuleSet()}
+	if *rulesPath != "" {
+		var err error
+		ruleSets, err = receipt.LoadRuleSets(*rulesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	rulebook, err := receipt.NewRulebook(*currentRuleSet, ruleSets...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *ratesPath != "" {
+		rates, err := receipt.LoadExchangeRates(*ratesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rulebook, err = rulebook.WithExchangeRates(rates)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *layoutsPath != "" {
+		config.Layouts, err = receipt.LoadLayouts(*layoutsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var store Store
+	switch *storeKind {
+	case "memory":
+		store = newMemStore()
+	case "file":
+		fileStore, err := openFileStore(*dataPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = fileStore
+	default:
+		panic("The store flag must be memory or file")
+	}
+	defer store.Close()
+
+	if config.PointsExpireMonths > 0 {
+		go sweepExpiredPoints(store, config.ExpirySweepInterval)
+	}
+
 	router := chi.NewRouter()
 
 	router.Post("/receipts/process", func(res http.ResponseWriter, req *http.Request) {
-		processHandler(db, res, req)
+		processHandler(store, rulebook, config, res, req)
+	})
+
+	router.Post("/receipts/process:batch", func(res http.ResponseWriter, req *http.Request) {
+		batchHandler(store, rulebook, config, res, req)
+	})
+
+	router.Get("/receipts/{receiptId}", func(res http.ResponseWriter, req *http.Request) {
+		receiptHandler(store, res, req)
 	})
 
 	router.Get("/receipts/{receiptId}/points", func(res http.ResponseWriter, req *http.Request) {
-		pointsHandler(db, res, req)
+		pointsHandler(store, rulebook, res, req)
+	})
+
+	router.Get("/receipts/{receiptId}/points/breakdown", func(res http.ResponseWriter, req *http.Request) {
+		breakdownHandler(store, rulebook, res, req)
+	})
+
+	router.Post("/accounts", func(res http.ResponseWriter, req *http.Request) {
+		createAccountHandler(store, res, req)
+	})
+
+	router.Get("/accounts/{accountId}/balance", func(res http.ResponseWriter, req *http.Request) {
+		balanceHandler(store, res, req)
+	})
+
+	router.Get("/accounts/{accountId}/receipts", func(res http.ResponseWriter, req *http.Request) {
+		accountReceiptsHandler(store, res, req)
+	})
+
+	router.Get("/accounts/{accountId}/ledger", func(res http.ResponseWriter, req *http.Request) {
+		ledgerHandler(store, res, req)
+	})
+
+	router.Get("/accounts/{accountId}/tier", func(res http.ResponseWriter, req *http.Request) {
+		tierHandler(store, rulebook, res, req)
+	})
+
+	router.Get("/accounts/{accountId}/expiring", func(res http.ResponseWriter, req *http.Request) {
+		expiringHandler(store, res, req)
+	})
+
+	router.Post("/accounts/{accountId}/redemptions", func(res http.ResponseWriter, req *http.Request) {
+		redemptionHandler(store, res, req)
+	})
+
+	router.Post("/accounts/{accountId}/adjustments", func(res http.ResponseWriter, req *http.Request) {
+		adjustmentHandler(store, res, req)
+	})
+
+	router.Post("/campaigns", func(res http.ResponseWriter, req *http.Request) {
+		createCampaignHandler(store, res, req)
+	})
+
+	router.Get("/campaigns", func(res http.ResponseWriter, req *http.Request) {
+		campaignsHandler(store, res, req)
+	})
+
+	router.Get("/campaigns/{campaignId}", func(res http.ResponseWriter, req *http.Request) {
+		campaignHandler(store, res, req)
+	})
+
+	router.Put("/campaigns/{campaignId}", func(res http.ResponseWriter, req *http.Request) {
+		updateCampaignHandler(store, res, req)
+	})
+
+	router.Delete("/campaigns/{campaignId}", func(res http.ResponseWriter, req *http.Request) {
+		deleteCampaignHandler(store, res, req)
+	})
+
+	router.Post("/retailers", func(res http.ResponseWriter, req *http.Request) {
+		createRetailerHandler(store, res, req)
+	})
+
+	router.Get("/retailers", func(res http.ResponseWriter, req *http.Request) {
+		retailersHandler(store, res, req)
+	})
+
+	router.Post("/retailers/{retailerId}/merge", func(res http.ResponseWriter, req *http.Request) {
+		mergeRetailersHandler(store, res, req)
 	})
 
 	fmt.Println("Starting on port " + port)
-	err := http.ListenAndServe(":"+port, router)
+	err = http.ListenAndServe(":"+port, router)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -5,17 +5,22 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"danielHett/main/receipt"
 	"github.com/google/uuid"
 )
 
+var testRulebook, _ = receipt.NewRulebook("", receipt.DefaultRuleSet())
+
 func TestProcessHandler_ThrowsOnNoBody(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -24,7 +29,7 @@ func TestProcessHandler_ThrowsOnNoBody(t *testing.T) {
 }
 
 func TestProcessHandler_ThrowsOnMissingField(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "M&M Corner Market",
 		"purchaseDate": "2022-03-20",
@@ -46,7 +51,7 @@ func TestProcessHandler_ThrowsOnMissingField(t *testing.T) {
 		"total": "9.00"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -55,7 +60,7 @@ func TestProcessHandler_ThrowsOnMissingField(t *testing.T) {
 }
 
 func TestProcessHandler_ThrowsInvalidPrice(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "M&M Corner Market",
 		"purchaseDate": "2022-03-20",
@@ -78,7 +83,7 @@ func TestProcessHandler_ThrowsInvalidPrice(t *testing.T) {
 		"total": "9.525"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -87,7 +92,7 @@ func TestProcessHandler_ThrowsInvalidPrice(t *testing.T) {
 }
 
 func TestProcessHandler_ThrowsInvalidDate(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "M&M Corner Market",
 		"purchaseDate": "2022-03-200",
@@ -110,7 +115,7 @@ func TestProcessHandler_ThrowsInvalidDate(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -119,7 +124,7 @@ func TestProcessHandler_ThrowsInvalidDate(t *testing.T) {
 }
 
 func TestProcessHandler_ThrowsNoItems(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "M&M Corner Market",
 		"purchaseDate": "2022-03-20",
@@ -129,7 +134,7 @@ func TestProcessHandler_ThrowsNoItems(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -138,7 +143,7 @@ func TestProcessHandler_ThrowsNoItems(t *testing.T) {
 }
 
 func TestProcessHandler_ThrowsInvalidTime(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "M&M Corner Market",
 		"purchaseDate": "2022-03-20",
@@ -161,7 +166,7 @@ func TestProcessHandler_ThrowsInvalidTime(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 400 {
@@ -170,7 +175,7 @@ func TestProcessHandler_ThrowsInvalidTime(t *testing.T) {
 }
 
 func TestProcessHandler_CorrectRetailerPoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "Daniel-Special-Shop   ",
 		"purchaseDate": "2022-03-20",
@@ -184,7 +189,7 @@ func TestProcessHandler_CorrectRetailerPoints(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -207,19 +212,18 @@ func TestProcessHandler_CorrectRetailerPoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 17 {
+	if stored.Points != 17 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectDatePoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "-",
 		"purchaseDate": "2022-03-21",
@@ -233,7 +237,7 @@ func TestProcessHandler_CorrectDatePoints(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -256,19 +260,18 @@ func TestProcessHandler_CorrectDatePoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 6 {
+	if stored.Points != 6 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectTimePoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "-",
 		"purchaseDate": "2022-03-20",
@@ -282,7 +285,7 @@ func TestProcessHandler_CorrectTimePoints(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -305,19 +308,18 @@ func TestProcessHandler_CorrectTimePoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 10 {
+	if stored.Points != 10 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectNumberOfItemsPoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "-",
 		"purchaseDate": "2022-03-20",
@@ -335,7 +337,7 @@ func TestProcessHandler_CorrectNumberOfItemsPoints(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -358,19 +360,18 @@ func TestProcessHandler_CorrectNumberOfItemsPoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 5 {
+	if stored.Points != 5 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectItemsPoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "-",
 		"purchaseDate": "2022-03-20",
@@ -384,7 +385,7 @@ func TestProcessHandler_CorrectItemsPoints(t *testing.T) {
 		"total": "9.52"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -407,19 +408,18 @@ func TestProcessHandler_CorrectItemsPoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 2 {
+	if stored.Points != 2 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectTotalPoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "-",
 		"purchaseDate": "2022-03-20",
@@ -433,7 +433,7 @@ func TestProcessHandler_CorrectTotalPoints(t *testing.T) {
 		"total": "10.00"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -456,19 +456,18 @@ func TestProcessHandler_CorrectTotalPoints(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 75 {
+	if stored.Points != 75 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestProcessHandler_CorrectForRealReceipt(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "Target",
 		"purchaseDate": "2022-01-01",
@@ -494,7 +493,7 @@ func TestProcessHandler_CorrectForRealReceipt(t *testing.T) {
 		"total": "35.35"
 	  }`))
 	w := httptest.NewRecorder()
-	processHandler(testDB, w, req)
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
@@ -517,19 +516,18 @@ func TestProcessHandler_CorrectForRealReceipt(t *testing.T) {
 		t.Error("Reponse body was not a valid UUID")
 	}
 
-	txn := testDB.Txn(false)
-	raw, err := txn.First("receipt", "id", processResponse.Id)
-	if err != nil || raw == nil {
-		t.Error("UUID not found in the DB")
+	stored, err := testStore.GetReceipt(processResponse.Id)
+	if err != nil {
+		t.Error("UUID not found in the store")
 	}
 
-	if raw.(*StoredReceipt).Points != 28 {
+	if stored.Points != 28 {
 		t.Error("Invalid points")
 	}
 }
 
 func TestPointsHandler_ReturnsPoints(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
 		"retailer": "Target",
 		"purchaseDate": "2022-01-01",
@@ -555,7 +553,7 @@ func TestPointsHandler_ReturnsPoints(t *testing.T) {
 		"total": "35.35"
 	  }`))
 	firstW := httptest.NewRecorder()
-	processHandler(testDB, firstW, req)
+	processHandler(testStore, testRulebook, defaultConfig, firstW, req)
 	firstRes := firstW.Result()
 	defer firstRes.Body.Close()
 	data, _ := ioutil.ReadAll(firstRes.Body)
@@ -563,7 +561,7 @@ func TestPointsHandler_ReturnsPoints(t *testing.T) {
 	json.Unmarshal(data, &processResponse)
 	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id+"/points", nil)
 	secondW := httptest.NewRecorder()
-	pointsHandler(testDB, secondW, req)
+	pointsHandler(testStore, testRulebook, secondW, req)
 	secondRes := secondW.Result()
 	if secondRes.StatusCode != 200 {
 		t.Error("Getting an incorrect status code")
@@ -577,12 +575,534 @@ func TestPointsHandler_ReturnsPoints(t *testing.T) {
 }
 
 func TestPointsHandler_FailsOnInvalidId(t *testing.T) {
-	testDB := createDB()
+	testStore := newMemStore()
 	req := httptest.NewRequest(http.MethodGet, "/receipts/8e55ce4d-4d0d-4765-babd-294711efc91b/points", nil)
 	w := httptest.NewRecorder()
-	pointsHandler(testDB, w, req)
+	pointsHandler(testStore, testRulebook, w, req)
 	res := w.Result()
 	if res.StatusCode != 404 {
 		t.Error("Getting an incorrect status code")
 	}
 }
+
+func TestBreakdownHandler_ReturnsRules(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "-",
+		"purchaseDate": "2022-03-21",
+		"purchaseTime": "14:30",
+		"items": [
+		  {
+			"shortDescription": "Hi",
+			"price": "2.25"
+		  }
+		],
+		"total": "9.52"
+	  }`))
+	firstW := httptest.NewRecorder()
+	processHandler(testStore, testRulebook, defaultConfig, firstW, req)
+	data, _ := ioutil.ReadAll(firstW.Result().Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id+"/points/breakdown", nil)
+	secondW := httptest.NewRecorder()
+	breakdownHandler(testStore, testRulebook, secondW, req)
+	secondRes := secondW.Result()
+	if secondRes.StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+	data, _ = ioutil.ReadAll(secondRes.Body)
+	var breakdownResponse BreakdownResponse
+	json.Unmarshal(data, &breakdownResponse)
+	if breakdownResponse.Points != 16 || len(breakdownResponse.Rules) != 2 {
+		t.Error("Invalid breakdown")
+	}
+	if breakdownResponse.Rules[0].Rule != "purchase_time" || breakdownResponse.Rules[0].Input != "14:30" {
+		t.Error("Invalid breakdown rule")
+	}
+}
+
+func TestBreakdownHandler_FailsOnInvalidId(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodGet, "/receipts/not-a-uuid/points/breakdown", nil)
+	w := httptest.NewRecorder()
+	breakdownHandler(testStore, testRulebook, w, req)
+	if w.Result().StatusCode != 404 {
+		t.Error("Getting an incorrect status code")
+	}
+}
+
+func TestReceiptHandler_ReturnsSubmittedReceipt(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [
+		  {
+			"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ",
+			"price": "12.00"
+		  }
+		],
+		"total": "12.00"
+	  }`))
+	firstW := httptest.NewRecorder()
+	processHandler(testStore, testRulebook, defaultConfig, firstW, req)
+	data, _ := ioutil.ReadAll(firstW.Result().Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id, nil)
+	secondW := httptest.NewRecorder()
+	receiptHandler(testStore, secondW, req)
+	secondRes := secondW.Result()
+	if secondRes.StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+	data, _ = ioutil.ReadAll(secondRes.Body)
+	var receiptResponse ReceiptResponse
+	json.Unmarshal(data, &receiptResponse)
+	if receiptResponse.Id != processResponse.Id || receiptResponse.Retailer != "Target" ||
+		receiptResponse.PurchaseTime != "13:01" || receiptResponse.Total != "12.00" {
+		t.Error("Invalid receipt")
+	}
+	if len(receiptResponse.Items) != 1 || receiptResponse.Items[0].ShortDescription != "   Klarbrunn 12-PK 12 FL OZ  " {
+		t.Error("Items were not stored as submitted")
+	}
+	if receiptResponse.ProcessedAt.IsZero() {
+		t.Error("Missing processed-at timestamp")
+	}
+}
+
+func TestReceiptHandler_ReturnsPurchaseInstant(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "Target",
+		"purchasedAt": "2022-01-01T21:01:00Z",
+		"timeZone": "America/Chicago",
+		"items": [
+		  {
+			"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ",
+			"price": "12.00"
+		  }
+		],
+		"total": "12.00"
+	  }`))
+	firstW := httptest.NewRecorder()
+	processHandler(testStore, testRulebook, defaultConfig, firstW, req)
+	data, _ := ioutil.ReadAll(firstW.Result().Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id, nil)
+	secondW := httptest.NewRecorder()
+	receiptHandler(testStore, secondW, req)
+	data, _ = ioutil.ReadAll(secondW.Result().Body)
+	var receiptResponse ReceiptResponse
+	json.Unmarshal(data, &receiptResponse)
+	if !receiptResponse.PurchaseInstant.Equal(time.Date(2022, 1, 1, 21, 1, 0, 0, time.UTC)) || receiptResponse.TimeZone != "America/Chicago" {
+		t.Errorf("Invalid receipt: %s", data)
+	}
+
+	// 15:01 in Chicago is in the purchase time window.
+	stored, _ := testStore.GetReceipt(processResponse.Id)
+	if stored.Points != 6+75+3+10+6 {
+		t.Errorf("Invalid points: %+v", stored.Rules)
+	}
+}
+
+func TestRulesFile_MatchesDefaultRules(t *testing.T) {
+	ruleSet, err := receipt.LoadRuleSet("rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ruleSet, receipt.DefaultRuleSet()) {
+		t.Error("rules.json does not match the default rules")
+	}
+}
+
+func TestLayoutsFile_LoadsTheDefaultLayouts(t *testing.T) {
+	layouts, err := receipt.LoadLayouts("layouts.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layouts) != len(receipt.DefaultLayouts) || layouts[0].Name() != receipt.DefaultLayouts[0].Name() {
+		t.Error("layouts.json does not match the default layouts")
+	}
+}
+
+func TestPointsHandler_RescoresUnderRequestedRuleSet(t *testing.T) {
+	v2 := receipt.DefaultRuleSet()
+	v2.Version = "v2"
+	v2.Rules[0].Points = 3 // retailer_name
+	rulebook, err := receipt.NewRulebook("v1", receipt.DefaultRuleSet(), v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-02",
+		"purchaseTime": "13:01",
+		"items": [
+		  {
+			"shortDescription": "Hi",
+			"price": "2.25"
+		  }
+		],
+		"total": "9.52"
+	  }`))
+	firstW := httptest.NewRecorder()
+	processHandler(testStore, rulebook, defaultConfig, firstW, req)
+	data, _ := ioutil.ReadAll(firstW.Result().Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	stored, _ := testStore.GetReceipt(processResponse.Id)
+	if stored.RuleSet != "v1" {
+		t.Error("Rule set version was not stored")
+	}
+
+	tests := []struct {
+		query   string
+		points  int64
+		ruleSet string
+	}{
+		{"", 6, "v1"},
+		{"?ruleset=v1", 6, "v1"},
+		{"?ruleset=v2", 18, "v2"},
+	}
+	for _, test := range tests {
+		req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id+"/points"+test.query, nil)
+		w := httptest.NewRecorder()
+		pointsHandler(testStore, rulebook, w, req)
+		if w.Result().StatusCode != 200 {
+			t.Error("Getting an incorrect status code")
+		}
+		data, _ = ioutil.ReadAll(w.Result().Body)
+		var pointsResponse PointsResponse
+		json.Unmarshal(data, &pointsResponse)
+		if pointsResponse.Points != test.points || pointsResponse.RuleSet != test.ruleSet {
+			t.Errorf("%s: got %+v", test.query, pointsResponse)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/receipts/"+processResponse.Id+"/points?ruleset=v9", nil)
+	w := httptest.NewRecorder()
+	pointsHandler(testStore, rulebook, w, req)
+	if w.Result().StatusCode != 400 {
+		t.Error("Getting an incorrect status code for an unknown rule set")
+	}
+}
+
+func TestProcessHandler_ReconcilesTotal(t *testing.T) {
+	ruleSet := receipt.DefaultRuleSet()
+	ruleSet.Reconciliation = &receipt.ReconciliationConfig{Tolerance: "0.00", Action: receipt.ActionFlag}
+	rulebook, err := receipt.NewRulebook("", ruleSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "-",
+		"purchaseDate": "2022-03-20",
+		"purchaseTime": "16:00",
+		"items": [
+		  {
+			"shortDescription": "Hi",
+			"price": "2.25"
+		  }
+		],
+		"tax": "0.20",
+		"total": "9.52"
+	  }`))
+	w := httptest.NewRecorder()
+	processHandler(testStore, rulebook, defaultConfig, w, req)
+	res := w.Result()
+	if res.StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+	if len(processResponse.Flags) != 1 || processResponse.Flags[0].Code != "total_mismatch" {
+		t.Error("Mismatched total was not flagged")
+	}
+
+	stored, _ := testStore.GetReceipt(processResponse.Id)
+	if len(stored.Flags) != 1 || stored.Receipt.Tax != "0.20" {
+		t.Error("Flag or tax was not stored")
+	}
+}
+
+func TestProcessHandler_ReturnsProblemWithEveryInvalidField(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+		"retailer": "M&M Corner Market",
+		"purchaseDate": "2022-03-20",
+		"items": [
+		  {
+			"shortDescription": "Gatorade",
+			"price": "2.25"
+		  },{
+			"shortDescription": "Gatorade",
+			"price": "2.2"
+		  }
+		],
+		"total": "9.00"
+	  }`))
+	w := httptest.NewRecorder()
+	processHandler(testStore, testRulebook, defaultConfig, w, req)
+	res := w.Result()
+	if res.StatusCode != 400 {
+		t.Error("Getting an incorrect status code")
+	}
+	if res.Header.Get("Content-Type") != "application/problem+json" {
+		t.Error("Getting an incorrect content type")
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	if problem.Title != InvalidBodyResponse || problem.Status != 400 {
+		t.Error("Invalid problem")
+	}
+	if len(problem.Errors) != 2 ||
+		problem.Errors[0].Field != "purchaseTime" || problem.Errors[0].Code != "missing" ||
+		problem.Errors[1].Field != "items[1].price" || problem.Errors[1].Code != "invalid_format" {
+		t.Errorf("Invalid field errors: %s", data)
+	}
+}
+
+func TestBatchHandler_ScoresEachReceipt(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", strings.NewReader(`[
+		{
+		  "retailer": "-",
+		  "purchaseDate": "2022-03-21",
+		  "purchaseTime": "14:00",
+		  "items": [{ "shortDescription": "Hi", "price": "2.25" }],
+		  "total": "9.52"
+		},
+		{
+		  "retailer": "-",
+		  "purchaseDate": "2022-03-200",
+		  "purchaseTime": "14:00",
+		  "items": [{ "shortDescription": "Hi", "price": "2.25" }],
+		  "total": "9.52"
+		},
+		"not a receipt",
+		{
+		  "retailer": "-",
+		  "purchaseDate": "2022-03-20",
+		  "purchaseTime": "14:01",
+		  "items": [{ "shortDescription": "Hi", "price": "2.25" }],
+		  "total": "9.52"
+		}
+	  ]`))
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+	res := w.Result()
+	if res.StatusCode != 200 {
+		t.Error("Getting an incorrect status code")
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	var batchResponse BatchResponse
+	json.Unmarshal(data, &batchResponse)
+	if len(batchResponse.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %s", data)
+	}
+
+	for i, points := range map[int]int64{0: 6, 3: 10} {
+		stored, err := testStore.GetReceipt(batchResponse.Results[i].Id)
+		if err != nil || stored.Points != points {
+			t.Errorf("Receipt %d was not stored with %d points", i, points)
+		}
+	}
+	for _, i := range []int{1, 2} {
+		result := batchResponse.Results[i]
+		if result.Index != i || result.Id != "" || result.Error == nil || result.Error.Status != 400 {
+			t.Errorf("Receipt %d should have failed, got %+v", i, result)
+		}
+	}
+	if batchResponse.Results[1].Error.Errors[0].Field != "purchaseDate" {
+		t.Error("Invalid field error")
+	}
+}
+
+func TestBatchHandler_AcceptsNDJSON(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", strings.NewReader(
+		`{"retailer": "-", "purchaseDate": "2022-03-21", "purchaseTime": "14:00", "items": [{"shortDescription": "Hi", "price": "2.25"}], "total": "9.52"}`+"\n"+
+			"\n"+
+			`{"retailer": "-", "purchaseDate": "2022-03-20", "purchaseTime": "14:01", "items": [{"shortDescription": "Hi", "price": "2.25"}], "total": "9.52"}`+"\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var batchResponse BatchResponse
+	json.Unmarshal(data, &batchResponse)
+	if len(batchResponse.Results) != 2 || batchResponse.Results[0].Id == "" || batchResponse.Results[1].Id == "" {
+		t.Errorf("Expected 2 stored receipts, got %s", data)
+	}
+}
+
+func TestBatchHandler_ThrowsOnNonArray(t *testing.T) {
+	testStore := newMemStore()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", strings.NewReader(`{"retailer": "-"}`))
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+	if w.Result().StatusCode != 400 {
+		t.Error("Getting an incorrect status code")
+	}
+}
+
+func TestProcessHandler_ReplaysIdempotencyKey(t *testing.T) {
+	testStore := newMemStore()
+	body := `{
+		"retailer": "-",
+		"purchaseDate": "2022-03-21",
+		"purchaseTime": "14:00",
+		"items": [{ "shortDescription": "Hi", "price": "2.25" }],
+		"total": "9.52"
+	  }`
+	send := func(config Config, key string, body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		processHandler(testStore, testRulebook, config, w, req)
+		return w.Result()
+	}
+	readId := func(res *http.Response) string {
+		data, _ := ioutil.ReadAll(res.Body)
+		var processResponse ProcessResponse
+		json.Unmarshal(data, &processResponse)
+		return processResponse.Id
+	}
+
+	first := send(defaultConfig, "retry-1", body)
+	firstId := readId(first)
+	if first.StatusCode != 200 || firstId == "" {
+		t.Fatal("First request failed")
+	}
+
+	second := send(defaultConfig, "retry-1", body)
+	if second.StatusCode != 200 || readId(second) != firstId || second.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("Retry did not return the original response")
+	}
+
+	if send(defaultConfig, "retry-1", strings.Replace(body, "9.52", "9.53", 1)).StatusCode != 422 {
+		t.Error("Key reused with a different body should be refused")
+	}
+
+	// The same receipt under a new key is a duplicate, so let it through with a flag.
+	flagConfig := defaultConfig
+	flagConfig.Duplicates = DuplicatesFlag
+	if id := readId(send(flagConfig, "retry-2", body)); id == "" || id == firstId {
+		t.Error("A different key should create a new receipt")
+	}
+
+	expiredConfig := flagConfig
+	expiredConfig.IdempotencyWindow = 0
+	if id := readId(send(expiredConfig, "retry-1", body)); id == "" || id == firstId {
+		t.Error("An expired key should create a new receipt")
+	}
+}
+
+func TestProcessHandler_DetectsDuplicates(t *testing.T) {
+	testStore := newMemStore()
+	send := func(config Config, retailer string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+			"retailer": "`+retailer+`",
+			"purchaseDate": "2022-03-21",
+			"purchaseTime": "14:00",
+			"items": [{ "shortDescription": "Hi", "price": "2.25" }],
+			"total": "9.52"
+		  }`))
+		w := httptest.NewRecorder()
+		processHandler(testStore, testRulebook, config, w, req)
+		return w.Result()
+	}
+
+	first := send(defaultConfig, "Corner Market")
+	data, _ := ioutil.ReadAll(first.Body)
+	var processResponse ProcessResponse
+	json.Unmarshal(data, &processResponse)
+
+	second := send(defaultConfig, "CORNER  MARKET")
+	if second.StatusCode != 409 {
+		t.Fatal("Getting an incorrect status code")
+	}
+	data, _ = ioutil.ReadAll(second.Body)
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	if problem.ReceiptId != processResponse.Id {
+		t.Error("Conflict does not reference the original receipt")
+	}
+
+	flagConfig := defaultConfig
+	flagConfig.Duplicates = DuplicatesFlag
+	third := send(flagConfig, "Corner Market")
+	data, _ = ioutil.ReadAll(third.Body)
+	var flaggedResponse ProcessResponse
+	json.Unmarshal(data, &flaggedResponse)
+	if third.StatusCode != 200 || len(flaggedResponse.Flags) != 1 || flaggedResponse.Flags[0].Code != DuplicateCode {
+		t.Error("Duplicate was not flagged")
+	}
+	stored, _ := testStore.GetReceipt(flaggedResponse.Id)
+	if stored.DuplicateOf != processResponse.Id {
+		t.Error("Duplicate does not reference the original receipt")
+	}
+}
+
+func TestBatchHandler_RefusesDuplicates(t *testing.T) {
+	testStore := newMemStore()
+	receiptJSON := `{"retailer": "-", "purchaseDate": "2022-03-21", "purchaseTime": "14:00", "items": [{"shortDescription": "Hi", "price": "2.25"}], "total": "9.52"}`
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", strings.NewReader("["+receiptJSON+","+receiptJSON+"]"))
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var batchResponse BatchResponse
+	json.Unmarshal(data, &batchResponse)
+	first, second := batchResponse.Results[0], batchResponse.Results[1]
+	if first.Id == "" || second.Error == nil || second.Error.Status != 409 || second.Error.ReceiptId != first.Id {
+		t.Errorf("Expected the second receipt to be refused as a duplicate, got %s", data)
+	}
+	if _, err := testStore.GetReceipt(first.Id); err != nil {
+		t.Error("First receipt was not stored")
+	}
+}
+
+func TestProcessHandler_RefusesFutureAndOldPurchases(t *testing.T) {
+	testStore := newMemStore()
+	config := defaultConfig
+	config.SubmissionWindow = 90 * 24 * time.Hour
+
+	for date, code := range map[string]string{
+		time.Now().AddDate(0, 0, 2).Format("2006-01-02"): receipt.CodeFutureDate,
+		"2022-01-01": receipt.CodeDateTooOld,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(`{
+			"retailer": "Target",
+			"purchaseDate": "`+date+`",
+			"purchaseTime": "13:01",
+			"items": [{ "shortDescription": "Pepsi - 12-oz", "price": "1.25" }],
+			"total": "1.25"
+		  }`))
+		w := httptest.NewRecorder()
+		processHandler(testStore, testRulebook, config, w, req)
+		data, _ := ioutil.ReadAll(w.Result().Body)
+		var problem Problem
+		json.Unmarshal(data, &problem)
+		if w.Result().StatusCode != 400 || len(problem.Errors) != 1 || problem.Errors[0].Code != code {
+			t.Errorf("%s: expected %s, got %s", date, code, data)
+		}
+	}
+}
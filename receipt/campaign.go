@@ -0,0 +1,140 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A time-boxed promotion applied on top of the rules. It matches receipts purchased from
+// Start to End (both inclusive dates) and, if set, whose retailer is Retailer and with an
+// item whose description contains ItemDescription and whose category is Category, all
+// ignoring letter case. A matching receipt earns either Bonus points or Multiplier times
+// the points of the rules. An account earns at most AccountCap points from the campaign,
+// if it is set.
+type Campaign struct {
+	Id              string   `json:"id"`
+	Name            string   `json:"name"`
+	Retailer        string   `json:"retailer,omitempty"`
+	ItemDescription string   `json:"itemDescription,omitempty"`
+	Category        string   `json:"category,omitempty"`
+	Start           string   `json:"start"`
+	End             string   `json:"end"`
+	Bonus           int64    `json:"bonus,omitempty"`
+	Multiplier      *Decimal `json:"multiplier,omitempty"`
+	AccountCap      int64    `json:"accountCap,omitempty"`
+}
+
+/**
+* Checks that the campaign is complete and consistent. Every problem is returned in a
+* ValidationErrors, using the JSON names of the fields.
+ */
+func (c Campaign) Validate() error {
+	var errs ValidationErrors
+
+	if c.Name == "" {
+		errs = append(errs, missing("name"))
+	}
+	for _, date := range []struct{ field, value string }{{"start", c.Start}, {"end", c.End}} {
+		if date.value == "" {
+			errs = append(errs, missing(date.field))
+		} else if !dateRegexp.MatchString(date.value) {
+			errs = append(errs, invalidFormat(date.field, datePattern))
+		} else if !calendarDate(date.value) {
+			errs = append(errs, invalidDate(date.field))
+		}
+	}
+	if calendarDate(c.Start) && calendarDate(c.End) && c.End < c.Start {
+		errs = append(errs, invalidValue("end", "must not be before start"))
+	}
+
+	if (c.Bonus != 0) == (c.Multiplier != nil) {
+		errs = append(errs, invalidValue("bonus", "exactly one of bonus and multiplier is required"))
+	} else if c.Bonus < 0 {
+		errs = append(errs, invalidValue("bonus", "must be positive"))
+	} else if c.Multiplier != nil && c.Multiplier.Cmp(decimalOne) <= 0 {
+		errs = append(errs, invalidValue("multiplier", "must be more than 1"))
+	}
+	if c.AccountCap < 0 {
+		errs = append(errs, invalidValue("accountCap", "must not be negative"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+/**
+* Returns whether the receipt matches the campaign, and what it matched on. Only sales
+* match, and not through their discounts.
+ */
+func (c Campaign) match(r Receipt) (bool, string) {
+	if r.kind() != ReceiptSale {
+		return false, ""
+	}
+	if r.PurchaseDate < c.Start || r.PurchaseDate > c.End {
+		return false, ""
+	}
+	input := r.PurchaseDate
+
+	if c.Retailer != "" {
+		if NormalizeRetailer(r.Retailer) != NormalizeRetailer(c.Retailer) {
+			return false, ""
+		}
+		input += ", " + r.Retailer
+	}
+
+	if c.ItemDescription != "" || c.Category != "" {
+		want := strings.ToLower(c.ItemDescription)
+		matched := false
+		for i, item := range r.Items {
+			if strings.HasPrefix(item.Price, "-") {
+				continue
+			}
+			if c.Category != "" && !strings.EqualFold(strings.TrimSpace(item.Category), strings.TrimSpace(c.Category)) {
+				continue
+			}
+			if strings.Contains(strings.ToLower(item.ShortDescription), want) {
+				input += fmt.Sprintf(", items[%d]: %q", i, strings.TrimSpace(item.ShortDescription))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, ""
+		}
+	}
+
+	return true, input
+}
+
+/**
+* Applies every campaign that matches the receipt, each as a rule of its own. Multipliers
+* apply to the points of the rules, not of other campaigns. earned holds the points that
+* each campaign already awarded the account, by campaign id, so that caps are kept; it
+* may be nil.
+ */
+func (r *Result) ApplyCampaigns(receipt Receipt, campaigns []*Campaign, earned map[string]int64) {
+	rulePoints := r.Points
+	for _, campaign := range campaigns {
+		matched, input := campaign.match(receipt)
+		if !matched {
+			continue
+		}
+
+		points := campaign.Bonus
+		if campaign.Multiplier != nil {
+			points = campaign.Multiplier.roundTimes(rulePoints) - rulePoints
+		}
+		if campaign.AccountCap != 0 && points > campaign.AccountCap-earned[campaign.Id] {
+			points = campaign.AccountCap - earned[campaign.Id]
+		}
+		if points <= 0 {
+			continue
+		}
+
+		r.Points += points
+		r.Rules = append(r.Rules, RuleResult{Rule: RuleCampaign, Points: points, Input: input, Campaign: campaign.Id})
+	}
+}
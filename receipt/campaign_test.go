@@ -0,0 +1,67 @@
+package receipt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyCampaigns_MatchesAndCaps(t *testing.T) {
+	two := MustParseDecimal("2")
+	campaigns := []*Campaign{
+		{Id: "double", Name: "Double at Target", Retailer: "target", Start: "2022-01-01", End: "2022-01-31", Multiplier: &two},
+		{Id: "cheese", Name: "Cheese bonus", ItemDescription: "CHEESE", Start: "2022-01-01", End: "2022-01-01", Bonus: 100, AccountCap: 150},
+		{Id: "later", Name: "February", Start: "2022-02-01", End: "2022-02-28", Bonus: 100},
+		{Id: "walgreens", Name: "Walgreens", Retailer: "Walgreens", Start: "2022-01-01", End: "2022-12-31", Bonus: 100},
+	}
+
+	result, err := Score(targetReceipt())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result.ApplyCampaigns(targetReceipt(), campaigns, map[string]int64{"cheese": 100})
+	if result.Points != 28+28+50 {
+		t.Errorf("Invalid points: %d (%+v)", result.Points, result.Rules)
+	}
+
+	rules := result.Rules[len(result.Rules)-2:]
+	if rules[0].Campaign != "double" || rules[0].Points != 28 || rules[1].Campaign != "cheese" || rules[1].Points != 50 {
+		t.Errorf("Invalid campaign rules: %+v", rules)
+	}
+	if rules[1].Rule != RuleCampaign || rules[1].Input != `2022-01-01, items[1]: "Emils Cheese Pizza"` {
+		t.Errorf("Campaign is not explained: %+v", rules[1])
+	}
+}
+
+func TestApplyCampaigns_ComparesRetailersLikeTheCatalog(t *testing.T) {
+	campaign := &Campaign{Id: "corner", Name: "Corner bonus", Retailer: "M&M Corner Market", Start: "2022-01-01", End: "2022-12-31", Bonus: 100}
+	r := targetReceipt()
+	r.Retailer = "M & M CORNER MKT"
+	result, err := Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := result.Points
+	result.ApplyCampaigns(r, []*Campaign{campaign}, nil)
+	if result.Points != points+100 {
+		t.Errorf("Campaign did not match %q: %+v", r.Retailer, result.Rules)
+	}
+}
+
+func TestCampaign_Validate(t *testing.T) {
+	two := MustParseDecimal("2")
+	valid := Campaign{Name: "Double", Start: "2022-11-20", End: "2022-11-30", Multiplier: &two}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := Campaign{Start: "2022-11-30", End: "2022-11-20", Bonus: 10, Multiplier: &two, AccountCap: -1}
+	var errs ValidationErrors
+	if err := invalid.Validate(); !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatalf("Expected 4 errors, got %v", err)
+	}
+	if errs[0].Field != "name" || errs[1].Field != "end" || errs[2].Code != CodeInvalidValue {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,138 @@
+package receipt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The currency of receipts and rule sets that don't name one.
+const DefaultCurrency = "USD"
+
+// The number of decimal places of the supported ISO 4217 currencies.
+var currencyExponents = map[string]int{
+	"AUD": 2, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "HUF": 2, "INR": 2, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2,
+	"SEK": 2, "SGD": 2, "USD": 2, "ZAR": 2,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "VND": 0,
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+}
+
+const currencyPattern = `^[A-Z]{3}$`
+
+var currencyRegexp = regexp.MustCompile(currencyPattern)
+
+// The patterns of amounts with 0, 2 and 3 decimal places. amountPattern is the one with 2.
+// Each allows 12 digits at most.
+var amountPatterns = map[int]string{
+	0: `^[0-9]{1,12}$`,
+	2: amountPattern,
+	3: `^[0-9]{1,9}\.[0-9]{3}$`,
+}
+
+var amountRegexps = map[int]*regexp.Regexp{
+	0: regexp.MustCompile(amountPatterns[0]),
+	2: amountRegexp,
+	3: regexp.MustCompile(amountPatterns[3]),
+}
+
+// The patterns of amounts on receipts, which may also be negative.
+var signedAmountPatterns = map[int]string{}
+var signedAmountRegexps = map[int]*regexp.Regexp{}
+
+func init() {
+	for exponent, pattern := range amountPatterns {
+		signedAmountPatterns[exponent] = "^-?" + strings.TrimPrefix(pattern, "^")
+		signedAmountRegexps[exponent] = regexp.MustCompile(signedAmountPatterns[exponent])
+	}
+}
+
+// Converts an amount that matched the pattern for the number of decimal places, or its
+// signed version, to minor units.
+func parseAmount(amount string, exponent int) Money {
+	negative := strings.HasPrefix(amount, "-")
+	var units Money = 0
+	for _, c := range strings.Replace(strings.TrimPrefix(amount, "-"), ".", "", 1) {
+		units = units*10 + Money(c-'0')
+	}
+
+	if negative {
+		return -units
+	}
+	return units
+}
+
+// Formats minor units as an amount with the number of decimal places.
+func formatAmount(m Money, exponent int) string {
+	if exponent == 0 {
+		return fmt.Sprintf("%d", m)
+	}
+
+	return Decimal{int64(m), exponent}.String()
+}
+
+// Exchange rates into a base currency: one unit of each currency in Rates is worth its
+// rate in units of Base. Receipts in other currencies are converted with these before
+// they are scored, so that the amounts in the rules are always in Base.
+type ExchangeRates struct {
+	Base  string             `json:"base"`
+	Rates map[string]Decimal `json:"rates"`
+}
+
+/**
+* Reads and checks the exchange rates file at path.
+ */
+func LoadExchangeRates(path string) (ExchangeRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ExchangeRates{}, err
+	}
+
+	var rates ExchangeRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return ExchangeRates{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rates.check(); err != nil {
+		return ExchangeRates{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rates, nil
+}
+
+// Checks that every currency is supported and every rate is positive.
+func (rates ExchangeRates) check() error {
+	if _, found := currencyExponents[rates.Base]; !found {
+		return fmt.Errorf("base currency %q is not supported", rates.Base)
+	}
+	for currency, rate := range rates.Rates {
+		if _, found := currencyExponents[currency]; !found {
+			return fmt.Errorf("currency %q is not supported", currency)
+		}
+		if rate.Sign() <= 0 {
+			return fmt.Errorf("the rate of %s must be positive", currency)
+		}
+	}
+
+	return nil
+}
+
+/**
+* Returns the factor that converts minor units of a currency with the exponent into minor
+* units of the base currency, at the rate.
+ */
+func conversionFactor(exponent int, rate Decimal, baseExponent int) *big.Rat {
+	scale := new(big.Rat).SetFrac(pow10(baseExponent), pow10(exponent))
+	return scale.Mul(scale, rate.rat())
+}
+
+// Multiplies an amount by the factor, rounding halves up.
+func scaleMoney(amount Money, factor *big.Rat) Money {
+	return Money(roundRat(new(big.Rat).Mul(factor, new(big.Rat).SetInt64(int64(amount)))))
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
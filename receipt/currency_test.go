@@ -0,0 +1,157 @@
+package receipt
+
+import (
+	"errors"
+	"testing"
+)
+
+func yenReceipt() Receipt {
+	return Receipt{
+		Retailer:     "Lawson",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "10:00",
+		Items:        []Item{{ShortDescription: "abc", Price: "15000"}},
+		Total:        "15000",
+		Currency:     "JPY",
+	}
+}
+
+func convertingEngine(t *testing.T, set RuleSet) *Engine {
+	rates, err := LoadExchangeRates("../rates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := mustNewEngine(set).WithExchangeRates(rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return engine
+}
+
+func TestScore_ConvertsToTheCurrencyOfTheRules(t *testing.T) {
+	engine := convertingEngine(t, DefaultRuleSet())
+
+	// 15000 JPY is 100.50 USD: 6 for the name, 25 for the quarter and 21 for the item.
+	result, err := engine.Score(yenReceipt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != 52 {
+		t.Errorf("Invalid points: %d (%+v)", result.Points, result.Rules)
+	}
+
+	if _, err := DefaultEngine.Score(yenReceipt()); !hasCode(err, CodeNoExchangeRate) {
+		t.Errorf("Expected no_exchange_rate without rates, got %v", err)
+	}
+}
+
+func TestValidate_AmountsFollowTheCurrency(t *testing.T) {
+	engine := convertingEngine(t, DefaultRuleSet())
+
+	tests := []struct {
+		name     string
+		currency string
+		total    string
+		code     string
+	}{
+		{"yen with decimals", "JPY", "15000.00", CodeInvalidFormat},
+		{"dinar with three decimals", "KWD", "1.250", ""},
+		{"dinar with two decimals", "KWD", "1.25", CodeInvalidFormat},
+		{"lower case", "usd", "1.25", CodeInvalidFormat},
+		{"unsupported", "XYZ", "1.25", CodeUnknownCurrency},
+	}
+
+	for _, test := range tests {
+		r := yenReceipt()
+		r.Currency, r.Total = test.currency, test.total
+		r.Items[0].Price = test.total
+		_, err := engine.Score(r)
+		if test.code == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if test.code != "" && !hasCode(err, test.code) {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+	}
+}
+
+func TestReconciliation_InTheCurrencyOfTheReceipt(t *testing.T) {
+	set := DefaultRuleSet()
+	set.Reconciliation = &ReconciliationConfig{Tolerance: "0.05", Action: ActionReject}
+	engine := convertingEngine(t, set)
+
+	// The tolerance of 0.05 USD is 7 JPY.
+	r := yenReceipt()
+	r.Items = []Item{{ShortDescription: "Onigiri", Price: "100"}, {ShortDescription: "Tea", Price: "200"}}
+	r.Total = "307"
+	if _, err := engine.Score(r); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	r.Total = "308"
+	var mismatch *ValidationError
+	if _, err := engine.Score(r); !errors.As(err, &mismatch) || mismatch.Message != "expected 300, not 308" {
+		t.Errorf("Expected a mismatch in yen, got %v", err)
+	}
+}
+
+func TestWithExchangeRates_RequiresTheSameBase(t *testing.T) {
+	set := DefaultRuleSet()
+	set.Currency = "EUR"
+	book, err := NewRulebook("", set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := book.WithExchangeRates(ExchangeRates{Base: "USD"}); err == nil {
+		t.Error("Expected an error for rates into another currency")
+	}
+	if _, err := book.WithExchangeRates(ExchangeRates{Base: "EUR", Rates: map[string]Decimal{"USD": MustParseDecimal("0")}}); err == nil {
+		t.Error("Expected an error for a zero rate")
+	}
+}
+
+func TestParseAmount_FollowsTheExponent(t *testing.T) {
+	tests := []struct {
+		amount   string
+		exponent int
+		units    Money
+	}{
+		{"12.05", 2, 1205},
+		{"-0.05", 2, -5},
+		{"1500", 0, 1500},
+		{"1.250", 3, 1250},
+		{"-0.001", 3, -1},
+	}
+	for _, test := range tests {
+		if !signedAmountRegexps[test.exponent].MatchString(test.amount) {
+			t.Errorf("%s should match %s", test.amount, signedAmountPatterns[test.exponent])
+		}
+		if units := parseAmount(test.amount, test.exponent); units != test.units {
+			t.Errorf("%s: expected %d, got %d", test.amount, test.units, units)
+		}
+		if amount := formatAmount(test.units, test.exponent); amount != test.amount {
+			t.Errorf("%d: expected %s, got %s", test.units, test.amount, amount)
+		}
+	}
+
+	for exponent, amount := range map[int]string{0: "12.05", 2: "12.5", 3: "12.05"} {
+		if amountRegexps[exponent].MatchString(amount) {
+			t.Errorf("%s should not match %s", amount, amountPatterns[exponent])
+		}
+	}
+}
+
+func hasCode(err error, code string) bool {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, e := range errs {
+		if e.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore_RejectsDaysNotOnTheCalendar(t *testing.T) {
+	tests := []struct {
+		date string
+		code string
+	}{
+		{"2022-02-31", CodeInvalidDate},
+		{"2023-04-31", CodeInvalidDate},
+		{"2023-02-29", CodeInvalidDate},
+		{"2024-02-29", ""},
+		{"2022-13-01", CodeInvalidFormat},
+	}
+
+	for _, test := range tests {
+		r := targetReceipt()
+		r.PurchaseDate = test.date
+		_, err := Score(r)
+		if test.code == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.date, err)
+		} else if test.code != "" && !hasCode(err, test.code) {
+			t.Errorf("%s: expected %s, got %v", test.date, test.code, err)
+		}
+	}
+
+	campaign := Campaign{Name: "Leap day", Start: "2023-02-29", End: "2023-03-01", Bonus: 10}
+	if err := campaign.Validate(); !hasCode(err, CodeInvalidDate) {
+		t.Errorf("Expected invalid_date for the campaign, got %v", err)
+	}
+}
+
+func TestCheckPurchaseDate(t *testing.T) {
+	now := time.Date(2022, 3, 20, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		date        string
+		clock       string
+		purchasedAt string
+		code        string
+	}{
+		{"just purchased", "2022-03-20", "12:00", "", ""},
+		{"ahead of utc", "2022-03-21", "01:30", "", ""},
+		{"tomorrow", "2022-03-21", "12:00", "", CodeFutureDate},
+		{"within the skew", "", "", "2022-03-20T12:04:00Z", ""},
+		{"beyond the skew", "", "", "2022-03-20T12:06:00Z", CodeFutureDate},
+		{"within the window", "2022-02-19", "12:00", "", ""},
+		{"before the window", "2022-02-17", "12:00", "", CodeDateTooOld},
+	}
+
+	for _, test := range tests {
+		r := targetReceipt()
+		r.PurchaseDate, r.PurchaseTime, r.PurchasedAt = test.date, test.clock, test.purchasedAt
+		err := CheckPurchaseDate(r, now, 5*time.Minute, 30*24*time.Hour)
+		if test.code == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if test.code != "" && !hasCode(err, test.code) {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+	}
+
+	// Without a window a receipt can be of any age.
+	r := targetReceipt()
+	if err := CheckPurchaseDate(r, now, 0, 0); err != nil {
+		t.Errorf("Unexpected error without a window: %v", err)
+	}
+}
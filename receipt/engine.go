@@ -0,0 +1,358 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Applies a rule set to receipts. An Engine is safe for concurrent use.
+type Engine struct {
+	version   string
+	rules     []namedRule
+	reconcile *reconciler
+	tiers     *tierPolicy
+	retailers map[string]*retailerOverride
+
+	// The currency of the rules, its decimal places, and the rates of other currencies
+	// into it.
+	currency string
+	exponent int
+	rates    map[string]Decimal
+}
+
+// A receipt being scored, with its amounts converted to minor units of the currency of
+// the rules. The embedded Receipt keeps the amounts as submitted, and exponent and rate
+// are those of its own currency.
+type pricedReceipt struct {
+	Receipt
+	total    Money
+	prices   []Money
+	exponent int
+	rate     Decimal
+}
+
+// A compiled rule. It adds the points it awards to the result.
+type rule func(r pricedReceipt, result *Result)
+
+// A compiled rule and the name it was configured with. Item rules score the items of a
+// receipt, and the other rules the receipt as a whole.
+type namedRule struct {
+	name  string
+	apply rule
+	item  bool
+}
+
+// Scores receipts with the rules provided in the challenge.
+var DefaultEngine = mustNewEngine(DefaultRuleSet())
+
+/**
+* Validates the rule set and compiles it into an Engine.
+ */
+func NewEngine(set RuleSet) (*Engine, error) {
+	if set.Version == "" {
+		return nil, errors.New("rule set has no version")
+	}
+	if len(set.Rules) == 0 {
+		return nil, errors.New("rule set has no rules")
+	}
+
+	engine := &Engine{version: set.Version, currency: set.Currency}
+	if engine.currency == "" {
+		engine.currency = DefaultCurrency
+	}
+	exponent, found := currencyExponents[engine.currency]
+	if !found {
+		return nil, fmt.Errorf("currency %q is not supported", set.Currency)
+	}
+	engine.exponent = exponent
+
+	for i, config := range set.Rules {
+		compiled, err := compileRule(config, exponent)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		item := config.Type == TypeItemCount || config.Type == TypeItemDescriptionLength
+		engine.rules = append(engine.rules, namedRule{config.Name, compiled, item})
+	}
+
+	retailers, err := compileRetailers(set.Retailers, set.Rules)
+	if err != nil {
+		return nil, err
+	}
+	engine.retailers = retailers
+
+	if set.Reconciliation != nil {
+		reconcile, err := compileReconciliation(*set.Reconciliation, exponent)
+		if err != nil {
+			return nil, fmt.Errorf("reconciliation: %w", err)
+		}
+		engine.reconcile = reconcile
+	}
+
+	if set.Tiers != nil {
+		tiers, err := compileTiers(*set.Tiers, exponent)
+		if err != nil {
+			return nil, fmt.Errorf("tiers: %w", err)
+		}
+		engine.tiers = tiers
+	}
+
+	return engine, nil
+}
+
+func mustNewEngine(set RuleSet) *Engine {
+	engine, err := NewEngine(set)
+	if err != nil {
+		panic(err)
+	}
+
+	return engine
+}
+
+// The version of the rule set the engine applies.
+func (e *Engine) Version() string {
+	return e.version
+}
+
+/**
+* Returns a copy of the engine that scores receipts in the currencies of the exchange
+* rates by converting them to its own currency, which must be their base.
+ */
+func (e *Engine) WithExchangeRates(rates ExchangeRates) (*Engine, error) {
+	if err := rates.check(); err != nil {
+		return nil, err
+	}
+	if rates.Base != e.currency {
+		return nil, fmt.Errorf("the rules are in %s but the exchange rates are into %s", e.currency, rates.Base)
+	}
+
+	engine := *e
+	engine.rates = rates.Rates
+	return &engine, nil
+}
+
+/**
+* Converts the amounts of a valid receipt to the engine's currency. Fails with a
+* ValidationErrors if there is no exchange rate for the receipt's currency.
+ */
+func (e *Engine) price(r Receipt) (pricedReceipt, error) {
+	currency := r.Currency
+	if currency == "" {
+		currency = e.currency
+	}
+
+	rate := decimalOne
+	if currency != e.currency {
+		var found bool
+		rate, found = e.rates[currency]
+		if !found {
+			return pricedReceipt{}, ValidationErrors{{
+				Field:   "currency",
+				Code:    CodeNoExchangeRate,
+				Message: fmt.Sprintf("there is no exchange rate from %s to %s", currency, e.currency),
+			}}
+		}
+	}
+
+	priced := pricedReceipt{Receipt: r, exponent: currencyExponents[currency], rate: rate}
+	factor := conversionFactor(priced.exponent, rate, e.exponent)
+	priced.total = scaleMoney(parseAmount(r.Total, priced.exponent), factor)
+	for _, item := range r.Items {
+		priced.prices = append(priced.prices, scaleMoney(parseAmount(item.Price, priced.exponent), factor))
+	}
+
+	return priced, nil
+}
+
+/**
+* Scores the receipt with the default rules. If the receipt is invalid the returned
+* error is a ValidationErrors listing every problem.
+ */
+func Score(r Receipt) (Result, error) {
+	return DefaultEngine.Score(r)
+}
+
+/**
+* Scores the receipt with the engine's rules, in the local time of the store. If the
+* receipt is invalid the returned error is a ValidationErrors listing every problem.
+ */
+func (e *Engine) Score(r Receipt) (Result, error) {
+	if err := validate(r, e.currency); err != nil {
+		return Result{}, err
+	}
+	r = r.Localized()
+	priced, err := e.price(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Rules: []RuleResult{}}
+	if e.reconcile != nil {
+		if mismatch := e.reconcile.check(priced); mismatch != nil {
+			if !e.reconcile.flag {
+				return Result{}, ValidationErrors{mismatch}
+			}
+			result.Flags = append(result.Flags, mismatch)
+		}
+	}
+
+	// A return earns nothing of its own; its points are taken back with ClawBack. An
+	// exchange only earns the item rules for the items it adds, so that swapping an item
+	// for one like it earns as much as ClawBack takes back.
+	switch r.kind() {
+	case ReceiptSale:
+		e.apply(priced, &result)
+	case ReceiptExchange:
+		e.applyItemRules(priced, &result)
+	}
+
+	return result, nil
+}
+
+/**
+* Applies the rules to a priced receipt. A retailer with overrides is scored under its
+* own name, without its disabled rules.
+ */
+func (e *Engine) apply(r pricedReceipt, result *Result) {
+	override := e.retailers[NormalizeRetailer(r.Retailer)]
+	if override != nil {
+		r.Retailer = override.name
+	}
+
+	for _, rule := range e.rules {
+		if override == nil || !override.disabled[rule.name] {
+			rule.apply(r, result)
+		}
+	}
+
+	if override != nil {
+		result.award(RulePartnerBonus, override.bonus, override.name)
+	}
+}
+
+/**
+* Applies only the item rules to a priced receipt, without the overrides of its retailer
+* other than its disabled rules.
+ */
+func (e *Engine) applyItemRules(r pricedReceipt, result *Result) {
+	override := e.retailers[NormalizeRetailer(r.Retailer)]
+	for _, rule := range e.rules {
+		if rule.item && (override == nil || !override.disabled[rule.name]) {
+			rule.apply(r, result)
+		}
+	}
+}
+
+/**
+* Checks a single rule's configuration and builds the function that applies it. Amounts
+* in the configuration have the decimal places given by exponent.
+ */
+func compileRule(config RuleConfig, exponent int) (rule, error) {
+	if config.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if config.Points < 0 {
+		return nil, errors.New("points must not be negative")
+	}
+
+	switch config.Type {
+	case TypeRetailerAlphanumeric:
+		// Rule: Points for every alphanumeric character in the retailer name.
+		return func(r pricedReceipt, result *Result) {
+			var count int64 = 0
+			for _, c := range r.Retailer {
+				if unicode.IsLetter(c) || unicode.IsNumber(c) {
+					count++
+				}
+			}
+			result.award(config.Name, config.Points*count, r.Retailer)
+		}, nil
+
+	case TypeItemCount:
+		if config.Every <= 0 {
+			return nil, errors.New("every must be positive")
+		}
+		// Rule: Points for every `every` items on the receipt, counting the quantity of each
+		// line. Discounts and returned items, the lines with a negative price, don't count.
+		return func(r pricedReceipt, result *Result) {
+			count := 0
+			for _, item := range r.Items {
+				if !strings.HasPrefix(item.Price, "-") {
+					count += item.count()
+				}
+			}
+			points := config.Points * int64(count/config.Every)
+			result.award(config.Name, points, fmt.Sprintf("%d items", count))
+		}, nil
+
+	case TypeTotalMultiple:
+		if !amountRegexps[exponent].MatchString(config.AmountMultiple) || parseAmount(config.AmountMultiple, exponent) == 0 {
+			return nil, errors.New("amountMultiple must be a positive amount like 0.25")
+		}
+		multiple := parseAmount(config.AmountMultiple, exponent)
+		// Rule: Points if the total is a multiple of the amount, and not negative.
+		return func(r pricedReceipt, result *Result) {
+			if r.total >= 0 && r.total%multiple == 0 {
+				result.award(config.Name, config.Points, r.Total)
+			}
+		}, nil
+
+	case TypeItemDescriptionLength:
+		if config.LengthMultiple <= 0 {
+			return nil, errors.New("lengthMultiple must be positive")
+		}
+		if config.PriceMultiplier.Sign() <= 0 {
+			return nil, errors.New("priceMultiplier must be positive")
+		}
+		// Rule: If the trimmed length of the item description is a multiple of the length,
+		// multiply the price by the multiplier and round up to the nearest integer. Discounts
+		// and returned items don't count.
+		return func(r pricedReceipt, result *Result) {
+			for i, item := range r.Items {
+				trimmedDesc := strings.TrimSpace(item.ShortDescription)
+				if r.prices[i] <= 0 || len(trimmedDesc)%config.LengthMultiple != 0 {
+					continue
+				}
+				points := config.PriceMultiplier.ceilTimes(int64(r.prices[i]), pow10(exponent).Int64())
+				input := fmt.Sprintf("items[%d]: %q has length %d, price %s", i, trimmedDesc, len(trimmedDesc), item.Price)
+				result.award(config.Name, points, input)
+			}
+		}, nil
+
+	case TypePurchaseTimeWindow:
+		if !timeRegexp.MatchString(config.Start) || !timeRegexp.MatchString(config.End) {
+			return nil, errors.New("start and end must be times like 14:00")
+		}
+		start, end := parseMinutes(config.Start), parseMinutes(config.End)
+		if start >= end {
+			return nil, errors.New("start must be before end")
+		}
+		// Rule: Points if the time of purchase is after the start and before the end.
+		return func(r pricedReceipt, result *Result) {
+			minutes := parseMinutes(r.PurchaseTime)
+			if minutes > start && minutes < end {
+				result.award(config.Name, config.Points, r.PurchaseTime)
+			}
+		}, nil
+
+	case TypePurchaseDayParity:
+		if config.Parity != "odd" && config.Parity != "even" {
+			return nil, errors.New(`parity must be "odd" or "even"`)
+		}
+		remainder := 0
+		if config.Parity == "odd" {
+			remainder = 1
+		}
+		// Rule: Points if the day in the purchase date is odd (or even).
+		return func(r pricedReceipt, result *Result) {
+			if parseDay(r.PurchaseDate)%2 == remainder {
+				result.award(config.Name, config.Points, r.PurchaseDate)
+			}
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown type %q", config.Type)
+	}
+}
@@ -0,0 +1,89 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codes identifying why a receipt failed validation.
+const (
+	CodeMissing       = "missing"
+	CodeInvalidFormat = "invalid_format"
+	CodeNoItems       = "no_items"
+	CodeInvalidValue  = "invalid_value"
+
+	// The currency is not supported, or there is no rate to convert it to the currency
+	// of the rules.
+	CodeUnknownCurrency = "unknown_currency"
+	CodeNoExchangeRate  = "no_exchange_rate"
+
+	// The date is not a day of the calendar. A purchase can also be dated in the future,
+	// or be too old to be submitted.
+	CodeInvalidDate = "invalid_date"
+	CodeFutureDate  = "future_date"
+	CodeDateTooOld  = "date_too_old"
+
+	// A line of a text receipt matched none of the patterns of its layout.
+	CodeUnparsedLine = "unparsed_line"
+
+	// The price of an item is not its quantity times its unit price.
+	CodePriceMismatch = "price_mismatch"
+
+	// A returned item is not on the original receipt, or was already returned.
+	CodeNotOnOriginal = "not_on_original"
+
+	// The item prices don't add up to the subtotal, or the subtotal and tax (or the
+	// item prices) don't add up to the total.
+	CodeSubtotalMismatch = "subtotal_mismatch"
+	CodeTotalMismatch    = "total_mismatch"
+)
+
+// A single problem with a field of a receipt. Field uses the JSON names of the receipt,
+// e.g. "items[2].price".
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Every problem found with a receipt. Score returns this when the receipt is invalid;
+// errors.As can also pull out the first *ValidationError.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+func missing(field string) *ValidationError {
+	return &ValidationError{Field: field, Code: CodeMissing, Message: "is required"}
+}
+
+func invalidFormat(field string, pattern string) *ValidationError {
+	return &ValidationError{Field: field, Code: CodeInvalidFormat, Message: "must match " + pattern}
+}
+
+func invalidDate(field string) *ValidationError {
+	return &ValidationError{Field: field, Code: CodeInvalidDate, Message: "is not a day of the calendar"}
+}
+
+func invalidValue(field string, message string) *ValidationError {
+	return &ValidationError{Field: field, Code: CodeInvalidValue, Message: message}
+}
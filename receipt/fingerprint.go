@@ -0,0 +1,39 @@
+package receipt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+/**
+* Returns a fingerprint of the contents of a receipt: its retailer, purchase date and
+* time, total, currency, type and items. Two submissions of the same physical receipt
+* have the same fingerprint even if they differ in letter case, spacing or the order of
+* the items.
+ */
+func Fingerprint(r Receipt) string {
+	items := make([]string, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = canonicalText(item.ShortDescription) + "|" + item.Price
+	}
+	sort.Strings(items)
+
+	canonical := []string{canonicalText(r.Retailer), r.PurchaseDate, r.PurchaseTime, r.Total}
+	if r.Currency != "" {
+		canonical = append(canonical, r.Currency)
+	}
+	if r.kind() != ReceiptSale {
+		canonical = append(canonical, r.kind(), r.OriginalReceiptId)
+	}
+	canonical = append(canonical, items...)
+	sum := sha256.Sum256([]byte(strings.Join(canonical, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Lower cases the text and collapses every run of whitespace into a single space.
+func canonicalText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
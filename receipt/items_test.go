@@ -0,0 +1,95 @@
+package receipt
+
+import "testing"
+
+func gatoradeReceipt() Receipt {
+	return Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items:        []Item{{ShortDescription: "Gatorade", Price: "9.00", Quantity: 4, UnitPrice: "2.25", UPC: "052000328653", Category: "Drinks"}},
+		Total:        "9.00",
+	}
+}
+
+func TestScore_CountsQuantities(t *testing.T) {
+	// The same points as four separate Gatorade items.
+	result, err := Score(gatoradeReceipt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != 109 {
+		t.Errorf("Invalid points: %d (%+v)", result.Points, result.Rules)
+	}
+}
+
+func TestScore_ValidatesItemDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(item *Item)
+		field string
+		code  string
+	}{
+		{"wrong price", func(item *Item) { item.Quantity = 3 }, "items[0].price", CodePriceMismatch},
+		{"unit price without quantity", func(item *Item) { item.Quantity = 0 }, "items[0].price", CodePriceMismatch},
+		{"negative quantity", func(item *Item) { item.Quantity = -4 }, "items[0].quantity", CodeInvalidValue},
+		{"huge quantity", func(item *Item) { item.Quantity, item.UnitPrice, item.Price = 1<<62, "1.00", "0.00" }, "items[0].quantity", CodeInvalidValue},
+		{"largest quantity", func(item *Item) { item.Quantity = 1000000 }, "items[0].price", CodePriceMismatch},
+		{"malformed unit price", func(item *Item) { item.UnitPrice = "2.2" }, "items[0].unitPrice", CodeInvalidFormat},
+		{"short upc", func(item *Item) { item.UPC = "12345" }, "items[0].upc", CodeInvalidFormat},
+		{"wrong check digit", func(item *Item) { item.UPC = "052000328654" }, "items[0].upc", CodeInvalidValue},
+	}
+
+	for _, test := range tests {
+		r := gatoradeReceipt()
+		test.edit(&r.Items[0])
+		_, err := Score(r)
+		errs, ok := err.(ValidationErrors)
+		if !ok || len(errs) != 1 || errs[0].Field != test.field || errs[0].Code != test.code {
+			t.Errorf("%s: expected %s on %s, got %v", test.name, test.code, test.field, err)
+		}
+	}
+}
+
+func TestApplyCampaigns_MatchesCategories(t *testing.T) {
+	campaign := &Campaign{Id: "drinks", Name: "Drinks", Category: "drinks", Start: "2022-03-01", End: "2022-03-31", Bonus: 100}
+
+	result := Result{}
+	result.ApplyCampaigns(gatoradeReceipt(), []*Campaign{campaign}, nil)
+	if result.Points != 100 {
+		t.Errorf("The campaign did not match the category: %+v", result)
+	}
+
+	r := gatoradeReceipt()
+	r.Items[0].Category = ""
+	result = Result{}
+	result.ApplyCampaigns(r, []*Campaign{campaign}, nil)
+	if result.Points != 0 {
+		t.Errorf("The campaign matched an item without a category: %+v", result)
+	}
+}
+
+func TestClawBack_ReturnsSomeOfTheUnits(t *testing.T) {
+	returned := Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-21",
+		PurchaseTime: "09:00",
+		Items:        []Item{{ShortDescription: "Gatorade", Price: "-2.25", Quantity: 1}},
+		Total:        "-2.25",
+		Type:         ReceiptReturn,
+	}
+
+	// Three Gatorades at 6.75 make one pair and are no longer a round total.
+	result, err := DefaultEngine.ClawBack(gatoradeReceipt(), nil, returned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != -55 {
+		t.Errorf("Invalid claw back: %+v", result)
+	}
+
+	returned.Items[0].Price = "-2.00"
+	if _, err := DefaultEngine.ClawBack(gatoradeReceipt(), nil, returned); !hasCode(err, CodeNotOnOriginal) {
+		t.Errorf("Expected not_on_original for another unit price, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An amount of money in minor units of its currency, e.g. cents. Amounts are only ever
+// parsed into and calculated with integers, so that ceilings and multiples are exact.
+type Money int64
+
+// An exact decimal number, such as a multiplier in a rules file. It is written in JSON
+// as a plain number but kept as an integer and a number of decimal places, so that 0.2
+// is exactly two tenths.
+type Decimal struct {
+	units  int64
+	places int
+}
+
+const decimalPattern = `^-?[0-9]{1,12}(\.[0-9]{1,6})?$`
+
+var decimalRegexp = regexp.MustCompile(decimalPattern)
+
+// The multiplier that leaves points as they are.
+var decimalOne = Decimal{1, 0}
+
+/**
+* Parses a decimal number like "1.5", with up to 6 decimal places.
+ */
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalRegexp.MatchString(s) {
+		return Decimal{}, fmt.Errorf("decimal %q must match %s", s, decimalPattern)
+	}
+
+	places := 0
+	if point := strings.IndexByte(s, '.'); point >= 0 {
+		places = len(s) - point - 1
+		s = s[:point] + s[point+1:]
+	}
+	units, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	return Decimal{units, places}, nil
+}
+
+/**
+* Like ParseDecimal, but panics if s is not a decimal number. For decimals written in
+* code.
+ */
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+func (d Decimal) String() string {
+	s := strconv.FormatInt(d.units, 10)
+	if d.places == 0 {
+		return s
+	}
+
+	sign := ""
+	if d.units < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= d.places {
+		s = strings.Repeat("0", d.places-len(s)+1) + s
+	}
+
+	return sign + s[:len(s)-d.places] + "." + s[len(s)-d.places:]
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseDecimal(string(data))
+	if err != nil {
+		return errors.New("must be a number like 1.5")
+	}
+
+	*d = parsed
+	return nil
+}
+
+// Compares the decimal with another, returning -1, 0 or 1.
+func (d Decimal) Cmp(other Decimal) int {
+	return d.rat().Cmp(other.rat())
+}
+
+// Returns -1, 0 or 1 for a negative, zero or positive decimal.
+func (d Decimal) Sign() int {
+	return d.rat().Sign()
+}
+
+func (d Decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(d.units), pow10(d.places))
+}
+
+// Returns n times the decimal, divided by divisor and rounded up.
+func (d Decimal) ceilTimes(n int64, divisor int64) int64 {
+	product := d.rat().Mul(d.rat(), new(big.Rat).SetFrac64(n, divisor))
+	quotient, remainder := new(big.Int).DivMod(product.Num(), product.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+
+	return quotient.Int64()
+}
+
+// Returns n times the decimal, rounded to the nearest integer, with halves rounded up.
+func (d Decimal) roundTimes(n int64) int64 {
+	return roundRat(d.rat().Mul(d.rat(), new(big.Rat).SetInt64(n)))
+}
+
+// Rounds a fraction to the nearest integer, with halves rounded up.
+func roundRat(r *big.Rat) int64 {
+	doubled := new(big.Int).Add(new(big.Int).Mul(r.Num(), big.NewInt(2)), r.Denom())
+	quotient, _ := new(big.Int).DivMod(doubled, new(big.Int).Mul(r.Denom(), big.NewInt(2)), new(big.Int))
+
+	return quotient.Int64()
+}
@@ -0,0 +1,67 @@
+package receipt
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecimal_CeilingIsExact(t *testing.T) {
+	// 1.1 * 50.00 is 55.000000000000007 in floating point, which would round up to 56.
+	set := DefaultRuleSet()
+	set.Rules[4].PriceMultiplier = MustParseDecimal("1.1")
+	engine, err := NewEngine(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := targetReceipt()
+	r.Items = []Item{{ShortDescription: "abc", Price: "50.00"}}
+	r.Total = "50.00"
+	result, err := engine.Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range result.Rules {
+		if rule.Rule == RuleItemDescription && rule.Points != 55 {
+			t.Errorf("Expected 55 points for the item, got %d", rule.Points)
+		}
+	}
+
+	tests := []struct {
+		decimal string
+		n       int64
+		ceil    int64
+		round   int64
+	}{
+		{"0.2", 1225, 3, 245},
+		{"0.2", 1000, 2, 200},
+		{"1.15", 10, 1, 12},
+		{"1.5", 75, 2, 113},
+		{"1.5", -75, -1, -112},
+	}
+	for _, test := range tests {
+		d := MustParseDecimal(test.decimal)
+		if ceil := d.ceilTimes(test.n, 100); ceil != test.ceil {
+			t.Errorf("ceil(%s * %d / 100): expected %d, got %d", test.decimal, test.n, test.ceil, ceil)
+		}
+		if round := d.roundTimes(test.n); round != test.round {
+			t.Errorf("round(%s * %d): expected %d, got %d", test.decimal, test.n, test.round, round)
+		}
+	}
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	var config RuleConfig
+	if err := json.Unmarshal([]byte(`{"priceMultiplier": 0.05}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(config.PriceMultiplier); string(data) != "0.05" {
+		t.Errorf("Expected 0.05, got %s", data)
+	}
+
+	for _, invalid := range []string{`"0.2"`, `1e-1`, `0.1234567`} {
+		if err := json.Unmarshal([]byte(`{"priceMultiplier": `+invalid+`}`), &config); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+}
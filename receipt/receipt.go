@@ -0,0 +1,121 @@
+/**
+* Package receipt implements the scoring rules for the receipt-processor challenge. It
+* has no dependency on the HTTP server, so anything that needs to score a receipt can
+* import it directly.
+ */
+
+package receipt
+
+// A receipt as submitted by a client. Subtotal and Tax are optional; when present they
+// are used to reconcile the item prices with the total. Currency is an ISO 4217 code,
+// and decides how many decimal places the amounts have; without it the amounts are in
+// the currency of the rules.
+//
+// Type is ReceiptSale if empty. Amounts may be negative: on a sale for discounts, and on
+// a return or exchange for the items given back. A return or exchange may name the
+// receipt the items were bought on in OriginalReceiptId, so their points are taken back.
+//
+// TimeZone is the IANA time zone of the store, and PurchasedAt an RFC 3339 timestamp
+// that can stand in for PurchaseDate and PurchaseTime. See Localized.
+type Receipt struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate,omitempty"`
+	PurchaseTime string `json:"purchaseTime,omitempty"`
+	PurchasedAt  string `json:"purchasedAt,omitempty"`
+	TimeZone     string `json:"timeZone,omitempty"`
+	Items        []Item `json:"items"`
+	Subtotal     string `json:"subtotal,omitempty"`
+	Tax          string `json:"tax,omitempty"`
+	Total        string `json:"total"`
+	Currency     string `json:"currency,omitempty"`
+
+	Type              string `json:"type,omitempty"`
+	OriginalReceiptId string `json:"originalReceiptId,omitempty"`
+}
+
+// The types of receipt.
+const (
+	ReceiptSale     = "sale"
+	ReceiptReturn   = "return"
+	ReceiptExchange = "exchange"
+)
+
+// A single line item on a receipt. Price is the price of the whole line: Quantity times
+// UnitPrice, if they are given. Quantity is 1 if it is zero. UPC is a 12 digit UPC-A
+// code, and SKU and Category are free text.
+type Item struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+	Quantity         int    `json:"quantity,omitempty"`
+	UnitPrice        string `json:"unitPrice,omitempty"`
+	SKU              string `json:"sku,omitempty"`
+	UPC              string `json:"upc,omitempty"`
+	Category         string `json:"category,omitempty"`
+}
+
+// The outcome of scoring a receipt. Rules lists every rule that awarded points, so
+// the entries always add up to Points. Flags lists problems that the rule set chose to
+// report instead of rejecting the receipt.
+type Result struct {
+	Points int64              `json:"points"`
+	Rules  []RuleResult       `json:"rules"`
+	Flags  []*ValidationError `json:"flags,omitempty"`
+}
+
+// The points a single rule awarded, and the part of the receipt that triggered it.
+// Campaign is the id of the campaign that awarded them, if it was one. ReturnedFrom is
+// the id of the receipt the points were taken back from, if they were.
+type RuleResult struct {
+	Rule         string `json:"rule"`
+	Points       int64  `json:"points"`
+	Input        string `json:"input"`
+	Campaign     string `json:"campaign,omitempty"`
+	ReturnedFrom string `json:"returnedFrom,omitempty"`
+}
+
+// Names of the rules, as they appear in RuleResult.
+const (
+	RuleRetailerName    = "retailer_name"
+	RuleItemPairs       = "item_pairs"
+	RuleRoundTotal      = "round_total"
+	RuleQuarterTotal    = "quarter_total"
+	RuleItemDescription = "item_description"
+	RulePurchaseTime    = "purchase_time"
+	RulePurchaseDay     = "purchase_day"
+
+	// The bonus of a retailer configured in the rule set.
+	RulePartnerBonus = "partner_bonus"
+
+	// The points of a promotional campaign, applied after the rules.
+	RuleCampaign = "campaign"
+
+	// The extra points of a membership tier, applied after every other rule.
+	RuleTierMultiplier = "tier_multiplier"
+)
+
+// The type of the receipt, ReceiptSale if it has none.
+func (r Receipt) kind() string {
+	if r.Type == "" {
+		return ReceiptSale
+	}
+
+	return r.Type
+}
+
+// The number of units on the line, 1 if it has no quantity.
+func (i Item) count() int {
+	if i.Quantity == 0 {
+		return 1
+	}
+
+	return i.Quantity
+}
+
+// Records the points of a rule on the result. Rules that awarded nothing are left out.
+func (r *Result) award(rule string, points int64, input string) {
+	if points == 0 {
+		return
+	}
+	r.Points += points
+	r.Rules = append(r.Rules, RuleResult{Rule: rule, Points: points, Input: input})
+}
@@ -0,0 +1,197 @@
+package receipt
+
+import (
+	"errors"
+	"testing"
+)
+
+func targetReceipt() Receipt {
+	return Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+}
+
+func TestScore_RealReceipt(t *testing.T) {
+	result, err := Score(targetReceipt())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Points != 28 {
+		t.Errorf("Invalid points: %d", result.Points)
+	}
+}
+
+func TestScore_CornerMarketReceipt(t *testing.T) {
+	result, err := Score(Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+		Total: "9.00",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Points != 109 {
+		t.Errorf("Invalid points: %d", result.Points)
+	}
+}
+
+func TestScore_ReturnsValidationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(r *Receipt)
+		field string
+		code  string
+	}{
+		{"missing retailer", func(r *Receipt) { r.Retailer = "" }, "retailer", CodeMissing},
+		{"bad date", func(r *Receipt) { r.PurchaseDate = "2022-03-200" }, "purchaseDate", CodeInvalidFormat},
+		{"bad time", func(r *Receipt) { r.PurchaseTime = "25:33" }, "purchaseTime", CodeInvalidFormat},
+		{"bad total", func(r *Receipt) { r.Total = "9.525" }, "total", CodeInvalidFormat},
+		{"no items", func(r *Receipt) { r.Items = nil }, "items", CodeNoItems},
+		{"bad price", func(r *Receipt) { r.Items[1].Price = "12" }, "items[1].price", CodeInvalidFormat},
+	}
+
+	for _, test := range tests {
+		r := targetReceipt()
+		test.edit(&r)
+		_, err := Score(r)
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("%s: expected a *ValidationError, got %v", test.name, err)
+			continue
+		}
+		if validationErr.Field != test.field || validationErr.Code != test.code {
+			t.Errorf("%s: got %s/%s", test.name, validationErr.Field, validationErr.Code)
+		}
+	}
+}
+
+func TestScore_BreakdownExplainsPoints(t *testing.T) {
+	result, err := Score(targetReceipt())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []RuleResult{
+		{Rule: RuleRetailerName, Points: 6},
+		{Rule: RuleItemPairs, Points: 10},
+		{Rule: RuleItemDescription, Points: 3},
+		{Rule: RuleItemDescription, Points: 3},
+		{Rule: RulePurchaseDay, Points: 6},
+	}
+	if len(result.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %+v", len(expected), result.Rules)
+	}
+
+	var sum int64 = 0
+	for i, rule := range result.Rules {
+		if rule.Rule != expected[i].Rule || rule.Points != expected[i].Points {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, expected[i], rule)
+		}
+		sum += rule.Points
+	}
+	if sum != result.Points {
+		t.Errorf("Rules add up to %d, not %d", sum, result.Points)
+	}
+	if result.Rules[2].Input != `items[1]: "Emils Cheese Pizza" has length 18, price 12.25` {
+		t.Errorf("Unexpected input: %s", result.Rules[2].Input)
+	}
+}
+
+func TestScore_CollectsEveryValidationError(t *testing.T) {
+	r := targetReceipt()
+	r.Retailer = ""
+	r.PurchaseTime = "25:33"
+	r.Items[2].Price = "1.2"
+	r.Items[4].ShortDescription = ""
+
+	_, err := Score(r)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+
+	expected := []string{"retailer", "purchaseTime", "items[2].price", "items[4].shortDescription"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+	for i, field := range expected {
+		if errs[i].Field != field {
+			t.Errorf("Error %d: expected %s, got %s", i, field, errs[i].Field)
+		}
+	}
+	if errs[2].Error() != `items[2].price: must match ^-?[0-9]{1,10}\.[0-9][0-9]$` {
+		t.Errorf("Unexpected message: %s", errs[2].Error())
+	}
+}
+
+func TestScore_RejectsAmountsTooLarge(t *testing.T) {
+	r := targetReceipt()
+	r.Total = "99999999999999999999.00"
+	if _, err := Score(r); !hasField(err, "total", CodeInvalidFormat) {
+		t.Errorf("Expected an invalid_format error for the total, got %v", err)
+	}
+
+	// 2^63 cents, which would wrap around to a negative price.
+	r = targetReceipt()
+	r.Items[0].Price = "92233720368547758.08"
+	if _, err := Score(r); !hasField(err, "items[0].price", CodeInvalidFormat) {
+		t.Errorf("Expected an invalid_format error for the price, got %v", err)
+	}
+
+	r = targetReceipt()
+	r.Items[0].Price = "9999999999.99"
+	if _, err := Score(r); hasField(err, "items[0].price", CodeInvalidFormat) {
+		t.Error("A price of 12 digits should be accepted")
+	}
+}
+
+// Returns whether err is a ValidationErrors with the code for the field.
+func hasField(err error, field string, code string) bool {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, e := range errs {
+		if e.Field == field && e.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestFingerprint_IgnoresFormatting(t *testing.T) {
+	original := targetReceipt()
+
+	reformatted := targetReceipt()
+	reformatted.Retailer = "  TARGET "
+	reformatted.Items[0], reformatted.Items[4] = reformatted.Items[4], reformatted.Items[0]
+	reformatted.Items[1].ShortDescription = "emils  cheese pizza"
+	if Fingerprint(original) != Fingerprint(reformatted) {
+		t.Error("Reformatted receipt should have the same fingerprint")
+	}
+
+	different := targetReceipt()
+	different.Items[1].Price = "12.26"
+	if Fingerprint(original) == Fingerprint(different) {
+		t.Error("Receipts with different prices should have different fingerprints")
+	}
+}
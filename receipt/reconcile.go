@@ -0,0 +1,92 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Configures the check that the item prices on a receipt add up to its total. Receipts
+// whose amounts differ by more than Tolerance, in the currency of the rules, are
+// rejected, or with Action "flag" are scored but carry the mismatch in Result.Flags.
+type ReconciliationConfig struct {
+	Tolerance string `json:"tolerance"`
+	Action    string `json:"action"`
+}
+
+// The actions a ReconciliationConfig can take on a mismatched receipt.
+const (
+	ActionReject = "reject"
+	ActionFlag   = "flag"
+)
+
+// A compiled ReconciliationConfig. exponent is that of the currency of the rules.
+type reconciler struct {
+	tolerance Money
+	exponent  int
+	flag      bool
+}
+
+/**
+* Checks a reconciliation config and builds the reconciler that applies it.
+ */
+func compileReconciliation(config ReconciliationConfig, exponent int) (*reconciler, error) {
+	if !amountRegexps[exponent].MatchString(config.Tolerance) {
+		return nil, errors.New("tolerance must be an amount like 0.05")
+	}
+	if config.Action != ActionReject && config.Action != ActionFlag {
+		return nil, fmt.Errorf("action must be %q or %q", ActionReject, ActionFlag)
+	}
+
+	return &reconciler{tolerance: parseAmount(config.Tolerance, exponent), exponent: exponent, flag: config.Action == ActionFlag}, nil
+}
+
+/**
+* Compares the item prices with the subtotal, and the subtotal plus tax with the total.
+* Without a subtotal the item prices stand in for it, and without tax it is zero. The
+* amounts are compared in the receipt's own currency, with the tolerance converted to it,
+* so that rounding the converted amounts can't cause a mismatch. Returns nil if every
+* amount is within the tolerance.
+ */
+func (c *reconciler) check(r pricedReceipt) *ValidationError {
+	tolerance := scaleMoney(c.tolerance, new(big.Rat).Inv(conversionFactor(r.exponent, r.rate, c.exponent)))
+	within := func(a Money, b Money) bool {
+		difference := a - b
+		if difference < 0 {
+			difference = -difference
+		}
+		return difference <= tolerance
+	}
+
+	var itemsSum Money = 0
+	for _, item := range r.Items {
+		itemsSum += parseAmount(item.Price, r.exponent)
+	}
+
+	subtotal := itemsSum
+	if r.Subtotal != "" {
+		subtotal = parseAmount(r.Subtotal, r.exponent)
+		if !within(itemsSum, subtotal) {
+			return &ValidationError{
+				Field:   "subtotal",
+				Code:    CodeSubtotalMismatch,
+				Message: fmt.Sprintf("items add up to %s, not %s", formatAmount(itemsSum, r.exponent), r.Subtotal),
+			}
+		}
+	}
+
+	var tax Money = 0
+	if r.Tax != "" {
+		tax = parseAmount(r.Tax, r.exponent)
+	}
+
+	if !within(subtotal+tax, parseAmount(r.Total, r.exponent)) {
+		return &ValidationError{
+			Field:   "total",
+			Code:    CodeTotalMismatch,
+			Message: fmt.Sprintf("expected %s, not %s", formatAmount(subtotal+tax, r.exponent), r.Total),
+		}
+	}
+
+	return nil
+}
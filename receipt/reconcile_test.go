@@ -0,0 +1,81 @@
+package receipt
+
+import (
+	"errors"
+	"testing"
+)
+
+func reconcilingEngine(t *testing.T, action string) *Engine {
+	set := DefaultRuleSet()
+	set.Reconciliation = &ReconciliationConfig{Tolerance: "0.05", Action: action}
+	engine, err := NewEngine(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return engine
+}
+
+func TestReconciliation_RejectsMismatchedTotal(t *testing.T) {
+	engine := reconcilingEngine(t, ActionReject)
+
+	// The items of the target receipt add up to 35.35.
+	tests := []struct {
+		name     string
+		subtotal string
+		tax      string
+		total    string
+		code     string
+	}{
+		{"matching total", "", "", "35.35", ""},
+		{"within tolerance", "", "", "35.40", ""},
+		{"outside tolerance", "", "", "35.41", CodeTotalMismatch},
+		{"total with tax", "35.35", "2.83", "38.18", ""},
+		{"tax without subtotal", "", "2.83", "38.18", ""},
+		{"wrong tax", "35.35", "2.83", "40.00", CodeTotalMismatch},
+		{"wrong subtotal", "30.00", "0.00", "30.00", CodeSubtotalMismatch},
+	}
+
+	for _, test := range tests {
+		r := targetReceipt()
+		r.Subtotal, r.Tax, r.Total = test.subtotal, test.tax, test.total
+		_, err := engine.Score(r)
+
+		var validationErr *ValidationError
+		if test.code == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if test.code != "" && (!errors.As(err, &validationErr) || validationErr.Code != test.code) {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+	}
+}
+
+func TestReconciliation_FlagsMismatchedTotal(t *testing.T) {
+	engine := reconcilingEngine(t, ActionFlag)
+
+	r := targetReceipt()
+	r.Total = "100.00"
+	result, err := engine.Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Flags) != 1 || result.Flags[0].Code != CodeTotalMismatch {
+		t.Errorf("Expected a total_mismatch flag, got %+v", result.Flags)
+	}
+	if result.Points != 103 {
+		t.Errorf("Flagged receipt should still be scored, got %d", result.Points)
+	}
+}
+
+func TestReconciliation_RejectsInvalidConfig(t *testing.T) {
+	set := DefaultRuleSet()
+	set.Reconciliation = &ReconciliationConfig{Tolerance: "5", Action: ActionReject}
+	if _, err := NewEngine(set); err == nil {
+		t.Error("Expected an error for an invalid tolerance")
+	}
+
+	set.Reconciliation = &ReconciliationConfig{Tolerance: "0.05", Action: "ignore"}
+	if _, err := NewEngine(set); err == nil {
+		t.Error("Expected an error for an invalid action")
+	}
+}
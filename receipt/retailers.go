@@ -0,0 +1,100 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Overrides the rules for a retailer the rules file names. A receipt matches it if its
+// retailer is Name or one of the Aliases, as NormalizeRetailer compares them, and is
+// then scored as if it came from Name. Bonus points are awarded to every receipt
+// from the retailer, and the rules named in DisabledRules award nothing for it.
+type RetailerConfig struct {
+	Name          string   `json:"name"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Bonus         int64    `json:"bonus,omitempty"`
+	DisabledRules []string `json:"disabledRules,omitempty"`
+}
+
+// A compiled RetailerConfig.
+type retailerOverride struct {
+	name     string
+	bonus    int64
+	disabled map[string]bool
+}
+
+/**
+* Checks the retailer configs against the rules they override and indexes them by the
+* normalized form of every name they match.
+ */
+func compileRetailers(configs []RetailerConfig, rules []RuleConfig) (map[string]*retailerOverride, error) {
+	ruleNames := map[string]bool{}
+	for _, config := range rules {
+		ruleNames[config.Name] = true
+	}
+
+	overrides := map[string]*retailerOverride{}
+	for i, config := range configs {
+		if NormalizeRetailer(config.Name) == "" {
+			return nil, fmt.Errorf("retailers[%d]: name is required", i)
+		}
+		if config.Bonus < 0 {
+			return nil, fmt.Errorf("retailers[%d]: bonus must not be negative", i)
+		}
+
+		override := &retailerOverride{name: config.Name, bonus: config.Bonus, disabled: map[string]bool{}}
+		for _, name := range config.DisabledRules {
+			if !ruleNames[name] {
+				return nil, fmt.Errorf("retailers[%d]: there is no rule named %q to disable", i, name)
+			}
+			override.disabled[name] = true
+		}
+
+		for _, name := range append([]string{config.Name}, config.Aliases...) {
+			key := NormalizeRetailer(name)
+			if key == "" {
+				return nil, fmt.Errorf("retailers[%d]: aliases must not be empty", i)
+			}
+			if other, found := overrides[key]; found && other != override {
+				return nil, fmt.Errorf("retailers[%d]: %q matches more than one retailer", i, name)
+			}
+			overrides[key] = override
+		}
+	}
+
+	return overrides, nil
+}
+
+// Abbreviations that are spelled out before retailer names are compared.
+var retailerAbbreviations = map[string]string{
+	"mkt":  "market",
+	"mkts": "markets",
+	"ctr":  "center",
+	"cntr": "center",
+	"dept": "department",
+	"co":   "company",
+	"corp": "corporation",
+	"intl": "international",
+	"phcy": "pharmacy",
+	"whse": "warehouse",
+}
+
+/**
+* Reduces a retailer name to the form it is compared in: lower case words of letters and
+* digits, with "&" read as "and" and abbreviations spelled out, joined without spaces.
+* Names that differ only in case, spacing, punctuation or abbreviations compare equal.
+ */
+func NormalizeRetailer(name string) string {
+	words := strings.FieldsFunc(strings.ReplaceAll(strings.ToLower(name), "&", " and "), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+
+	for i, word := range words {
+		if expansion, found := retailerAbbreviations[word]; found {
+			words[i] = expansion
+		}
+	}
+
+	return strings.Join(words, "")
+}
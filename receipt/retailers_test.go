@@ -0,0 +1,60 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRetailers_OverrideRules(t *testing.T) {
+	set := DefaultRuleSet()
+	set.Retailers = []RetailerConfig{
+		{Name: "M&M Corner Market", Aliases: []string{"M & M CORNER MKT"}, Bonus: 15, DisabledRules: []string{RulePurchaseDay}},
+	}
+	engine, err := NewEngine(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := targetReceipt()
+	for _, retailer := range []string{"M&M Corner Market", "m & m corner mkt", "M&M-CORNER-MKT"} {
+		r.Retailer = retailer
+		result, err := engine.Score(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 14 for the canonical name and 15 for the partner, but nothing for the odd day.
+		if result.Points != 14+10+6+15 {
+			t.Errorf("%s: invalid points %d (%+v)", retailer, result.Points, result.Rules)
+		}
+		if last := result.Rules[len(result.Rules)-1]; last.Rule != RulePartnerBonus || last.Input != "M&M Corner Market" {
+			t.Errorf("%s: partner bonus is not explained: %+v", retailer, last)
+		}
+	}
+
+	// Other retailers are scored as usual.
+	result, _ := engine.Score(targetReceipt())
+	if result.Points != 28 {
+		t.Errorf("Invalid points for Target: %d", result.Points)
+	}
+}
+
+func TestRetailers_RejectsInvalidOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		retailers []RetailerConfig
+		message   string
+	}{
+		{"unknown rule", []RetailerConfig{{Name: "Target", DisabledRules: []string{"lucky_number"}}}, "no rule named"},
+		{"ambiguous alias", []RetailerConfig{{Name: "Target"}, {Name: "Walgreens", Aliases: []string{"TARGET"}}}, "more than one retailer"},
+		{"missing name", []RetailerConfig{{Name: " - "}}, "name is required"},
+	}
+
+	for _, test := range tests {
+		set := DefaultRuleSet()
+		set.Retailers = test.retailers
+		if _, err := NewEngine(set); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.message, err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+* Works out the points to take back from an original receipt for the items that a return
+* or exchange gives back, which are its lines with a negative price. Each of them must
+* match, by description and price, an item of the original that none of the earlier
+* returns gave back already, or some of the units of one. The points taken back are,
+* rule by rule, what the rules gave the original with its remaining items less what they
+* give it without the returned ones. Nothing is taken back if the items earned nothing.
+* If a returned item doesn't match, or the currencies differ, the returned error is a
+* ValidationErrors.
+ */
+func (e *Engine) ClawBack(original Receipt, earlier []Receipt, returned Receipt) (Result, error) {
+	currency := e.ReceiptCurrency(original)
+	if e.ReceiptCurrency(returned) != currency {
+		return Result{}, ValidationErrors{invalidValue("currency", "must be "+currency+", the currency of the original receipt")}
+	}
+
+	remaining, kept, err := returnItems(original, earlier, returned, currencyExponents[currency])
+	if err != nil {
+		return Result{}, err
+	}
+
+	before, err := e.scoreItems(original, remaining)
+	if err != nil {
+		return Result{}, err
+	}
+	after, err := e.scoreItems(original, kept)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var names []string
+	difference := map[string]int64{}
+	for _, rule := range before.Rules {
+		if _, found := difference[rule.Rule]; !found {
+			names = append(names, rule.Rule)
+		}
+		difference[rule.Rule] += rule.Points
+	}
+	for _, rule := range after.Rules {
+		if _, found := difference[rule.Rule]; !found {
+			names = append(names, rule.Rule)
+		}
+		difference[rule.Rule] -= rule.Points
+	}
+
+	var descriptions []string
+	for _, item := range returned.Items {
+		if strings.HasPrefix(item.Price, "-") {
+			descriptions = append(descriptions, fmt.Sprintf("%q", strings.TrimSpace(item.ShortDescription)))
+		}
+	}
+	input := "returned " + strings.Join(descriptions, ", ")
+
+	result := Result{Rules: []RuleResult{}}
+	if before.Points-after.Points <= 0 {
+		return result, nil
+	}
+	for _, name := range names {
+		result.award(name, -difference[name], input)
+	}
+
+	return result, nil
+}
+
+/**
+* Checks that every item a return or exchange gives back matches an item of the original
+* receipt that none of the earlier returns gave back already, as ClawBack matches them.
+* The amounts are in the given currency, which is the ReceiptCurrency of the original
+* under the engine that scored it. If an item doesn't match, the returned error is a
+* ValidationErrors.
+ */
+func CheckReturnable(original Receipt, earlier []Receipt, returned Receipt, currency string) error {
+	_, _, err := returnItems(original, earlier, returned, currencyExponents[currency])
+	return err
+}
+
+/**
+* Returns the items of the original receipt that the earlier returns left, and those of
+* them that are still left after the returned receipt. Amounts have the decimal places
+* given by exponent. If a line of the returned receipt matches none of the items left,
+* the returned error is a ValidationErrors.
+ */
+func returnItems(original Receipt, earlier []Receipt, returned Receipt, exponent int) ([]Item, []Item, error) {
+	var remaining []Item
+	for _, item := range original.Items {
+		if !strings.HasPrefix(item.Price, "-") {
+			remaining = append(remaining, item)
+		}
+	}
+	for _, r := range earlier {
+		remaining, _ = removeReturned(remaining, r, exponent)
+	}
+
+	kept, unmatched := removeReturned(remaining, returned, exponent)
+	if len(unmatched) > 0 {
+		var errs ValidationErrors
+		for _, i := range unmatched {
+			errs = append(errs, &ValidationError{
+				Field:   fmt.Sprintf("items[%d]", i),
+				Code:    CodeNotOnOriginal,
+				Message: "is not an item of the original receipt that was not already returned",
+			})
+		}
+		return nil, nil, errs
+	}
+
+	return remaining, kept, nil
+}
+
+// The currency of the amounts of the receipt: the one it names, or the engine's if it
+// names none.
+func (e *Engine) ReceiptCurrency(r Receipt) string {
+	if r.Currency == "" {
+		return e.currency
+	}
+
+	return r.Currency
+}
+
+/**
+* Removes the items that a receipt gives back from the items, matching each of its lines
+* with a negative price to an item with the same description and the opposite price, or
+* to some of the units of an item with a larger quantity at the same unit price. Amounts
+* have the decimal places given by exponent. Returns the items that are left and the
+* indexes of the lines that matched nothing.
+ */
+func removeReturned(items []Item, r Receipt, exponent int) ([]Item, []int) {
+	left := append([]Item{}, items...)
+	var unmatched []int
+	for i, line := range r.Items {
+		if !strings.HasPrefix(line.Price, "-") {
+			continue
+		}
+
+		found := false
+		for j, item := range left {
+			if canonicalText(item.ShortDescription) != canonicalText(line.ShortDescription) {
+				continue
+			}
+			if item.Price == line.Price[1:] {
+				left = append(left[:j], left[j+1:]...)
+				found = true
+				break
+			}
+
+			price, returned := parseAmount(item.Price, exponent), -parseAmount(line.Price, exponent)
+			if line.count() < item.count() && returned*Money(item.count()) == price*Money(line.count()) {
+				item.Quantity = item.count() - line.count()
+				item.Price = formatAmount(price-returned, exponent)
+				left[j] = item
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, i)
+		}
+	}
+
+	return left, unmatched
+}
+
+/**
+* Scores the original receipt as if it had only the given items, with its total reduced
+* by the items that are missing. Nothing is awarded if no items are left.
+ */
+func (e *Engine) scoreItems(original Receipt, items []Item) (Result, error) {
+	result := Result{Rules: []RuleResult{}}
+	if len(items) == 0 {
+		return result, nil
+	}
+
+	exponent := currencyExponents[e.ReceiptCurrency(original)]
+	total := parseAmount(original.Total, exponent)
+	for _, item := range original.Items {
+		if !strings.HasPrefix(item.Price, "-") {
+			total -= parseAmount(item.Price, exponent)
+		}
+	}
+	for _, item := range items {
+		total += parseAmount(item.Price, exponent)
+	}
+
+	r := original.Localized()
+	r.Items, r.Total, r.Subtotal, r.Tax = items, formatAmount(total, exponent), "", ""
+	priced, err := e.price(r)
+	if err != nil {
+		return Result{}, err
+	}
+	e.apply(priced, &result)
+
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package receipt
+
+import "testing"
+
+func targetReturn(items ...Item) Receipt {
+	return Receipt{
+		Retailer:          "Target",
+		PurchaseDate:      "2022-01-05",
+		PurchaseTime:      "10:00",
+		Items:             items,
+		Total:             "-1.00",
+		Type:              ReceiptReturn,
+		OriginalReceiptId: "original",
+	}
+}
+
+func TestScore_DiscountsAndReturnsEarnNothing(t *testing.T) {
+	r := targetReceipt()
+	r.Items = append(r.Items, Item{ShortDescription: "Coupon", Price: "-1.00"})
+	r.Total = "34.35"
+	result, err := Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != 28 {
+		t.Errorf("Invalid points for a sale with a discount: %d", result.Points)
+	}
+
+	result, err = Score(targetReturn(Item{ShortDescription: "Emils Cheese Pizza", Price: "-12.25"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != 0 {
+		t.Errorf("A return earned %d points", result.Points)
+	}
+}
+
+func TestScore_CountsFreeItems(t *testing.T) {
+	// Only negative lines are left out of the item count, so v1 scores free items as before.
+	r := targetReceipt()
+	r.Items = []Item{{ShortDescription: "Gatorade", Price: "2.25"}, {ShortDescription: "Free sample", Price: "0.00"}}
+	r.Total = "2.25"
+	result, err := Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range result.Rules {
+		if rule.Rule == RuleItemPairs && rule.Points == 5 {
+			return
+		}
+	}
+	t.Errorf("Expected 5 points for the pair of items: %+v", result.Rules)
+}
+
+func TestScore_ValidatesTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(r *Receipt)
+		field string
+	}{
+		{"negative sale", func(r *Receipt) { r.Total = "-35.35" }, "total"},
+		{"sale with an original", func(r *Receipt) { r.OriginalReceiptId = "original" }, "originalReceiptId"},
+		{"unknown type", func(r *Receipt) { r.Type = "refund" }, "type"},
+		{"returned item bought", func(r *Receipt) { r.Type, r.Total = ReceiptReturn, "0.00" }, "items[0].price"},
+	}
+
+	for _, test := range tests {
+		r := targetReceipt()
+		test.edit(&r)
+		if r.Type == ReceiptReturn {
+			r.Items = r.Items[:1]
+		}
+		_, err := Score(r)
+		if !hasCode(err, CodeInvalidValue) || err.(ValidationErrors)[0].Field != test.field {
+			t.Errorf("%s: expected invalid_value on %s, got %v", test.name, test.field, err)
+		}
+	}
+}
+
+func TestClawBack_TakesBackThePointsOfTheItems(t *testing.T) {
+	pizza := targetReturn(Item{ShortDescription: "emils cheese  pizza", Price: "-12.25"})
+	result, err := DefaultEngine.ClawBack(targetReceipt(), nil, pizza)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != -3 || len(result.Rules) != 1 || result.Rules[0].Rule != RuleItemDescription {
+		t.Errorf("Invalid claw back for the pizza: %+v", result)
+	}
+
+	// With the pizza gone, returning the Mountain Dew leaves too few items for two pairs.
+	dew := targetReturn(Item{ShortDescription: "Mountain Dew 12PK", Price: "-6.49"})
+	result, err = DefaultEngine.ClawBack(targetReceipt(), []Receipt{pizza}, dew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != -5 || result.Rules[0].Rule != RuleItemPairs {
+		t.Errorf("Invalid claw back for the Mountain Dew: %+v", result)
+	}
+
+	var everything []Item
+	for _, item := range targetReceipt().Items {
+		everything = append(everything, Item{ShortDescription: item.ShortDescription, Price: "-" + item.Price})
+	}
+	result, err = DefaultEngine.ClawBack(targetReceipt(), nil, targetReturn(everything...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != -28 {
+		t.Errorf("Returning everything took back %d points, not 28", result.Points)
+	}
+}
+
+func TestClawBack_RejectsItemsNotOnTheOriginal(t *testing.T) {
+	pizza := targetReturn(Item{ShortDescription: "Emils Cheese Pizza", Price: "-12.25"})
+
+	if _, err := DefaultEngine.ClawBack(targetReceipt(), []Receipt{pizza}, pizza); !hasCode(err, CodeNotOnOriginal) {
+		t.Errorf("Expected not_on_original for an item returned twice, got %v", err)
+	}
+
+	cheaper := targetReturn(Item{ShortDescription: "Emils Cheese Pizza", Price: "-10.00"})
+	if _, err := DefaultEngine.ClawBack(targetReceipt(), nil, cheaper); !hasCode(err, CodeNotOnOriginal) {
+		t.Errorf("Expected not_on_original for another price, got %v", err)
+	}
+
+	euros := pizza
+	euros.Currency = "EUR"
+	if _, err := DefaultEngine.ClawBack(targetReceipt(), nil, euros); !hasCode(err, CodeInvalidValue) {
+		t.Errorf("Expected invalid_value for another currency, got %v", err)
+	}
+}
+
+func TestCheckReturnable_MatchesLikeClawBack(t *testing.T) {
+	original := targetReceipt()
+	original.Items = []Item{{ShortDescription: "Gatorade", Price: "9.00", Quantity: 4, UnitPrice: "2.25"}}
+	original.Total = "9.00"
+	one := targetReturn(Item{ShortDescription: "Gatorade", Price: "-2.25"})
+
+	if err := CheckReturnable(original, nil, one, DefaultEngine.ReceiptCurrency(original)); err != nil {
+		t.Errorf("Expected one of the four to be returnable, got %v", err)
+	}
+	three := []Receipt{one, one, one}
+	if err := CheckReturnable(original, three, one, DefaultEngine.ReceiptCurrency(original)); err != nil {
+		t.Errorf("Expected the last one to be returnable, got %v", err)
+	}
+	if err := CheckReturnable(original, append(three, one), one, DefaultEngine.ReceiptCurrency(original)); !hasCode(err, CodeNotOnOriginal) {
+		t.Errorf("Expected not_on_original for a fifth one, got %v", err)
+	}
+}
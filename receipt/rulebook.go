@@ -0,0 +1,87 @@
+package receipt
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Holds every version of the rules that stored receipts may have been scored with, and
+// which of them new receipts are scored with.
+type Rulebook struct {
+	engines map[string]*Engine
+	current *Engine
+}
+
+/**
+* Compiles the rule sets into a Rulebook. New receipts are scored with the current
+* version, which may be left empty if there is only one rule set.
+ */
+func NewRulebook(current string, sets ...RuleSet) (*Rulebook, error) {
+	book := &Rulebook{engines: map[string]*Engine{}}
+	for _, set := range sets {
+		engine, err := NewEngine(set)
+		if err != nil {
+			return nil, fmt.Errorf("rule set %s: %w", set.Version, err)
+		}
+		if _, found := book.engines[set.Version]; found {
+			return nil, fmt.Errorf("rule set %s is defined twice", set.Version)
+		}
+		book.engines[set.Version] = engine
+	}
+
+	if current == "" {
+		if len(sets) != 1 {
+			return nil, fmt.Errorf("%d rule sets were given, so the current version must be named", len(sets))
+		}
+		current = sets[0].Version
+	}
+
+	engine, found := book.engines[current]
+	if !found {
+		return nil, fmt.Errorf("rule set %s is not defined", current)
+	}
+	book.current = engine
+
+	return book, nil
+}
+
+/**
+* Returns a copy of the rulebook whose engines score receipts in the currencies of the
+* exchange rates. Every rule set must be in the base currency of the rates.
+ */
+func (b *Rulebook) WithExchangeRates(rates ExchangeRates) (*Rulebook, error) {
+	book := &Rulebook{engines: map[string]*Engine{}}
+	for version, engine := range b.engines {
+		converting, err := engine.WithExchangeRates(rates)
+		if err != nil {
+			return nil, fmt.Errorf("rule set %s: %w", version, err)
+		}
+		book.engines[version] = converting
+	}
+	book.current = book.engines[b.current.Version()]
+
+	return book, nil
+}
+
+// The engine for the rule set that new receipts are scored with.
+func (b *Rulebook) Current() *Engine {
+	return b.current
+}
+
+// The engine for the given version. The second return value is false if the version
+// is not in the rulebook.
+func (b *Rulebook) Engine(version string) (*Engine, bool) {
+	engine, found := b.engines[version]
+	return engine, found
+}
+
+// Every version in the rulebook, sorted.
+func (b *Rulebook) Versions() []string {
+	versions := make([]string, 0, len(b.engines))
+	for version := range b.engines {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	return versions
+}
@@ -0,0 +1,154 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A set of scoring rules, as loaded from a rules file. Rules are applied in order.
+// Version identifies the rule set once receipts have been scored with it, so a rule set
+// must never be changed after it is in use; copy it to a new version instead.
+type RuleSet struct {
+	Version string       `json:"version"`
+	Rules   []RuleConfig `json:"rules"`
+
+	// The ISO 4217 currency of the amounts in the rule set, DefaultCurrency if empty.
+	// Receipts in other currencies can only be scored with exchange rates into it.
+	Currency string `json:"currency,omitempty"`
+
+	// Optional. Without it receipts are scored however their amounts add up.
+	Reconciliation *ReconciliationConfig `json:"reconciliation,omitempty"`
+
+	// Optional. Without it every account earns the points the rules award.
+	Tiers *TierPolicy `json:"tiers,omitempty"`
+
+	// Optional. Overrides the rules for particular retailers.
+	Retailers []RetailerConfig `json:"retailers,omitempty"`
+}
+
+// The configuration of a single rule. Type picks what the rule looks at and which of
+// the other fields it uses; Name is what appears in RuleResult.
+type RuleConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// The points awarded, or for retailer_alphanumeric the points per character.
+	Points int64 `json:"points,omitempty"`
+
+	// item_count: points are awarded for every Every items.
+	Every int `json:"every,omitempty"`
+
+	// total_multiple: points are awarded if the total is a multiple of this amount.
+	AmountMultiple string `json:"amountMultiple,omitempty"`
+
+	// item_description_length: an item earns ceil(price * PriceMultiplier) points if
+	// its trimmed description length is a multiple of LengthMultiple.
+	LengthMultiple  int     `json:"lengthMultiple,omitempty"`
+	PriceMultiplier Decimal `json:"priceMultiplier,omitempty"`
+
+	// purchase_time_window: points are awarded if the purchase time is strictly after
+	// Start and strictly before End, both "HH:MM".
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// purchase_day_parity: points are awarded if the day of the month is "odd" or "even".
+	Parity string `json:"parity,omitempty"`
+}
+
+// The types of rule a RuleConfig can have.
+const (
+	TypeRetailerAlphanumeric  = "retailer_alphanumeric"
+	TypeItemCount             = "item_count"
+	TypeTotalMultiple         = "total_multiple"
+	TypeItemDescriptionLength = "item_description_length"
+	TypePurchaseTimeWindow    = "purchase_time_window"
+	TypePurchaseDayParity     = "purchase_day_parity"
+)
+
+// The version of the rules provided in the challenge.
+const DefaultVersion = "v1"
+
+/**
+* Returns the rules provided in the challenge.
+ */
+func DefaultRuleSet() RuleSet {
+	return RuleSet{Version: DefaultVersion, Rules: []RuleConfig{
+		{Name: RuleRetailerName, Type: TypeRetailerAlphanumeric, Points: 1},
+		{Name: RuleItemPairs, Type: TypeItemCount, Points: 5, Every: 2},
+		{Name: RuleRoundTotal, Type: TypeTotalMultiple, Points: 50, AmountMultiple: "1.00"},
+		{Name: RuleQuarterTotal, Type: TypeTotalMultiple, Points: 25, AmountMultiple: "0.25"},
+		{Name: RuleItemDescription, Type: TypeItemDescriptionLength, LengthMultiple: 3, PriceMultiplier: MustParseDecimal("0.2")},
+		{Name: RulePurchaseTime, Type: TypePurchaseTimeWindow, Points: 10, Start: "14:00", End: "16:00"},
+		{Name: RulePurchaseDay, Type: TypePurchaseDayParity, Points: 6, Parity: "odd"},
+	}}
+}
+
+/**
+* Parses a rule set from JSON. Unknown fields are rejected so that typos in a rules file
+* don't silently fall back to zero values. The rules are not validated until they are
+* passed to NewEngine.
+ */
+func ParseRuleSet(data []byte) (RuleSet, error) {
+	var set RuleSet
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&set); err != nil {
+		return RuleSet{}, err
+	}
+
+	return set, nil
+}
+
+/**
+* Reads and parses the rules file at path.
+ */
+func LoadRuleSet(path string) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	set, err := ParseRuleSet(data)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return set, nil
+}
+
+/**
+* Loads the rule sets at path, which is either a single rules file or a directory in
+* which every .json file is a rules file.
+ */
+func LoadRuleSets(path string) ([]RuleSet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		set, err := LoadRuleSet(path)
+		if err != nil {
+			return nil, err
+		}
+		return []RuleSet{set}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sets []RuleSet
+	for _, file := range files {
+		set, err := LoadRuleSet(file)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
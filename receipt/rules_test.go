@@ -0,0 +1,95 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewEngine_AppliesConfiguredValues(t *testing.T) {
+	set := DefaultRuleSet()
+	set.Rules[1].Points = 20                                // item_pairs
+	set.Rules[6].Parity = "even"                            // purchase_day
+	set.Rules[4].PriceMultiplier = MustParseDecimal("0.5")  // item_description
+	set.Rules[5].Start, set.Rules[5].End = "12:00", "14:00" // purchase_time
+
+	engine, err := NewEngine(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := targetReceipt()
+	r.PurchaseTime = "13:00"
+	result, err := engine.Score(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 for the name, 40 for two pairs, 7 + 6 for the items and 10 for the time.
+	if result.Points != 69 {
+		t.Errorf("Invalid points: %d (%+v)", result.Points, result.Rules)
+	}
+}
+
+func TestNewEngine_RejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(config *RuleConfig)
+	}{
+		{"unknown type", func(c *RuleConfig) { c.Type = "lucky_number" }},
+		{"missing name", func(c *RuleConfig) { c.Name = "" }},
+		{"negative points", func(c *RuleConfig) { c.Points = -1 }},
+		{"zero every", func(c *RuleConfig) { c.Type, c.Every = TypeItemCount, 0 }},
+		{"bad multiple", func(c *RuleConfig) { c.Type, c.AmountMultiple = TypeTotalMultiple, "0.2" }},
+		{"reversed window", func(c *RuleConfig) { c.Type, c.Start, c.End = TypePurchaseTimeWindow, "16:00", "14:00" }},
+		{"bad parity", func(c *RuleConfig) { c.Type, c.Parity = TypePurchaseDayParity, "prime" }},
+	}
+
+	for _, test := range tests {
+		set := DefaultRuleSet()
+		test.edit(&set.Rules[0])
+		if _, err := NewEngine(set); err == nil || !strings.HasPrefix(err.Error(), "rules[0]: ") {
+			t.Errorf("%s: expected an error for rules[0], got %v", test.name, err)
+		}
+	}
+
+	if _, err := NewEngine(RuleSet{}); err == nil {
+		t.Error("Expected an error for an empty rule set")
+	}
+}
+
+func TestParseRuleSet_RejectsUnknownFields(t *testing.T) {
+	_, err := ParseRuleSet([]byte(`{"rules": [{"name": "x", "type": "item_count", "pionts": 5, "every": 2}]}`))
+	if err == nil {
+		t.Error("Expected an error for a misspelled field")
+	}
+}
+
+func TestNewRulebook_SelectsCurrentVersion(t *testing.T) {
+	v2 := DefaultRuleSet()
+	v2.Version = "v2"
+	v2.Rules[1].Points = 20
+
+	if _, err := NewRulebook("", DefaultRuleSet(), v2); err == nil {
+		t.Error("Expected an error when the current version is ambiguous")
+	}
+	if _, err := NewRulebook("v3", DefaultRuleSet(), v2); err == nil {
+		t.Error("Expected an error for an undefined current version")
+	}
+	if _, err := NewRulebook("v1", DefaultRuleSet(), DefaultRuleSet()); err == nil {
+		t.Error("Expected an error for a duplicate version")
+	}
+
+	book, err := NewRulebook("v2", DefaultRuleSet(), v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Current().Version() != "v2" {
+		t.Error("Wrong current version")
+	}
+	if engine, found := book.Engine("v1"); !found || engine.Version() != "v1" {
+		t.Error("Older version is not loadable")
+	}
+	if versions := book.Versions(); len(versions) != 2 || versions[0] != "v1" {
+		t.Errorf("Unexpected versions: %v", versions)
+	}
+}
@@ -0,0 +1,409 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A template for reading the text of receipts printed in one layout. Each pattern is a
+// regular expression matched against one line of the text, which passes the values it
+// finds in named groups: date, time, description, price, quantity, unitPrice, subtotal,
+// tax and total. The date and time are read with the first of their Go layouts that
+// works, e.g. "01/02/2006" and "3:04 PM". The retailer is the first line of the text
+// unless Retailer is set, and lines matching one of Ignore are skipped. Currency and
+// TimeZone are set on the receipts, if given.
+type LayoutConfig struct {
+	Name        string   `json:"name"`
+	Retailer    string   `json:"retailer,omitempty"`
+	Date        string   `json:"date"`
+	DateFormats []string `json:"dateFormats"`
+	Time        string   `json:"time"`
+	TimeFormats []string `json:"timeFormats"`
+	Item        string   `json:"item"`
+	Subtotal    string   `json:"subtotal,omitempty"`
+	Tax         string   `json:"tax,omitempty"`
+	Total       string   `json:"total"`
+	Ignore      []string `json:"ignore,omitempty"`
+	Currency    string   `json:"currency,omitempty"`
+	TimeZone    string   `json:"timeZone,omitempty"`
+}
+
+// A compiled LayoutConfig.
+type Layout struct {
+	config                     LayoutConfig
+	retailer, date, time, item *regexp.Regexp
+	subtotal, tax, total       *regexp.Regexp
+	ignore                     []*regexp.Regexp
+}
+
+// Reads receipts in the layouts provided by DefaultLayoutConfigs.
+var DefaultLayouts = mustNewLayouts(DefaultLayoutConfigs())
+
+// A receipt read from text, the layout it was read with, and a flag for every line that
+// none of the layout's patterns matched.
+type ParsedText struct {
+	Receipt  Receipt
+	Layout   string
+	Unparsed []*ValidationError
+}
+
+// The layouts used if none are configured: a header with the retailer, the date and time
+// in US or ISO order, item lines ending in their price, and a total line.
+func DefaultLayoutConfigs() []LayoutConfig {
+	amount := `\$?(-?[0-9,]+\.[0-9]{2}-?)`
+	// Lines made only of these labels, numbers and amounts, like "VISA ****1234 35.35", and
+	// dividers. An item whose description starts with one of the labels is still read.
+	ignore := []string{`(?i)^\s*((?:(?:cash|change|visa|mastercard|amex|debit|credit|card|balance|thank you|receipt|store|tel|phone)\b[^a-z0-9]*)+[^a-z]*|[*=-]+\s*)$`}
+	item := `^\s*(?:(?P<quantity>[0-9]+)\s*[xX@]\s+)?(?P<description>\S.*?)\s+(?:@\s*\$?(?P<unitPrice>[0-9,]+\.[0-9]{2})\s+)?` + strings.Replace(amount, "(", "(?P<price>", 1) + `\s*$`
+	total := func(name string, label string) string {
+		return `(?i)^\s*` + label + `\s*:?\s+` + strings.Replace(amount, "(", "(?P<"+name+">", 1) + `\s*$`
+	}
+
+	return []LayoutConfig{
+		{
+			Name:        "us",
+			Date:        `(?P<date>[0-9]{1,2}/[0-9]{1,2}/[0-9]{4})`,
+			DateFormats: []string{"1/2/2006"},
+			Time:        `(?P<time>[0-9]{1,2}:[0-9]{2}(?::[0-9]{2})?(?:\s*[AaPp][Mm])?)`,
+			TimeFormats: []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM", "3:04 pm", "3:04pm"},
+			Item:        item,
+			Subtotal:    total("subtotal", `sub\s*-?\s*total`),
+			Tax:         total("tax", `(?:sales\s+)?tax`),
+			Total:       total("total", `total`),
+			Ignore:      ignore,
+		},
+		{
+			Name:        "iso",
+			Date:        `(?P<date>[0-9]{4}-[0-9]{2}-[0-9]{2})`,
+			DateFormats: []string{"2006-01-02"},
+			Time:        `(?P<time>[0-9]{2}:[0-9]{2}(?::[0-9]{2})?)`,
+			TimeFormats: []string{"15:04", "15:04:05"},
+			Item:        item,
+			Subtotal:    total("subtotal", `sub\s*-?\s*total`),
+			Tax:         total("tax", `(?:vat|tax)`),
+			Total:       total("total", `total`),
+			Ignore:      ignore,
+		},
+	}
+}
+
+/**
+* Reads and compiles the layouts in the JSON file at path, which holds an array of them.
+ */
+func LoadLayouts(path string) ([]*Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var configs []LayoutConfig
+	if err := decoder.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	layouts, err := NewLayouts(configs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return layouts, nil
+}
+
+/**
+* Checks the layouts and compiles them, keeping their order.
+ */
+func NewLayouts(configs []LayoutConfig) ([]*Layout, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("there are no layouts")
+	}
+
+	var layouts []*Layout
+	names := map[string]bool{}
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("layouts[%d]: name is required", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("layouts[%d]: name %q is used twice", i, config.Name)
+		}
+		names[config.Name] = true
+
+		layout, err := compileLayout(config)
+		if err != nil {
+			return nil, fmt.Errorf("layouts[%d]: %w", i, err)
+		}
+		layouts = append(layouts, layout)
+	}
+
+	return layouts, nil
+}
+
+func mustNewLayouts(configs []LayoutConfig) []*Layout {
+	layouts, err := NewLayouts(configs)
+	if err != nil {
+		panic(err)
+	}
+
+	return layouts
+}
+
+/**
+* Compiles the patterns of a layout, checking that each has the groups it must pass on.
+ */
+func compileLayout(config LayoutConfig) (*Layout, error) {
+	compile := func(field string, pattern string, required bool, groups ...string) (*regexp.Regexp, error) {
+		if pattern == "" {
+			if required {
+				return nil, fmt.Errorf("%s is required", field)
+			}
+			return nil, nil
+		}
+
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		for _, group := range groups {
+			if compiled.SubexpIndex(group) < 0 {
+				return nil, fmt.Errorf("%s must have a group named %s", field, group)
+			}
+		}
+		return compiled, nil
+	}
+
+	layout := &Layout{config: config}
+	var err error
+	if layout.retailer, err = compile("retailer", config.Retailer, false, "retailer"); err != nil {
+		return nil, err
+	}
+	if layout.date, err = compile("date", config.Date, true, "date"); err != nil {
+		return nil, err
+	}
+	if layout.time, err = compile("time", config.Time, true, "time"); err != nil {
+		return nil, err
+	}
+	if layout.item, err = compile("item", config.Item, true, "description", "price"); err != nil {
+		return nil, err
+	}
+	if layout.subtotal, err = compile("subtotal", config.Subtotal, false, "subtotal"); err != nil {
+		return nil, err
+	}
+	if layout.tax, err = compile("tax", config.Tax, false, "tax"); err != nil {
+		return nil, err
+	}
+	if layout.total, err = compile("total", config.Total, true, "total"); err != nil {
+		return nil, err
+	}
+	for i, pattern := range config.Ignore {
+		ignore, err := compile(fmt.Sprintf("ignore[%d]", i), pattern, true)
+		if err != nil {
+			return nil, err
+		}
+		layout.ignore = append(layout.ignore, ignore)
+	}
+
+	if len(config.DateFormats) == 0 || len(config.TimeFormats) == 0 {
+		return nil, errors.New("dateFormats and timeFormats are required")
+	}
+	if config.Currency != "" {
+		if _, found := currencyExponents[config.Currency]; !found {
+			return nil, fmt.Errorf("currency %q is not supported", config.Currency)
+		}
+	}
+	if config.TimeZone != "" {
+		if _, err := time.LoadLocation(config.TimeZone); err != nil {
+			return nil, fmt.Errorf("timeZone: %w", err)
+		}
+	}
+
+	return layout, nil
+}
+
+// The name of the layout.
+func (l *Layout) Name() string {
+	return l.config.Name
+}
+
+/**
+* Reads a receipt from text with the layouts. If name is set the layout with that name is
+* used, and the second return value is false if there isn't one. Otherwise the layout that
+* finds most of the date, time and total and leaves the fewest lines unparsed is used, or
+* the first of those that tie. The receipt is not validated.
+ */
+func ParseText(text string, layouts []*Layout, name string) (ParsedText, bool) {
+	var best ParsedText
+	found := false
+	for _, layout := range layouts {
+		if name != "" && layout.Name() != name {
+			continue
+		}
+
+		parsed := layout.Parse(text)
+		if !found || parsed.fitsBetter(best) {
+			best = parsed
+		}
+		found = true
+	}
+
+	return best, found
+}
+
+// Whether the text was read better than by another layout: this one found more of the
+// date, time and total, or as many and left fewer lines unparsed.
+func (p ParsedText) fitsBetter(other ParsedText) bool {
+	if p.fieldsFound() != other.fieldsFound() {
+		return p.fieldsFound() > other.fieldsFound()
+	}
+
+	return len(p.Unparsed) < len(other.Unparsed)
+}
+
+// How many of the date, time and total were read.
+func (p ParsedText) fieldsFound() int {
+	found := 0
+	for _, field := range []string{p.Receipt.PurchaseDate, p.Receipt.PurchaseTime, p.Receipt.Total} {
+		if field != "" {
+			found++
+		}
+	}
+
+	return found
+}
+
+/**
+* Reads a receipt from text with the layout. Each line that none of the patterns match is
+* flagged as unparsed, with its index among the lines of the text.
+ */
+func (l *Layout) Parse(text string) ParsedText {
+	parsed := ParsedText{Layout: l.config.Name}
+	r := &parsed.Receipt
+	r.Currency, r.TimeZone = l.config.Currency, l.config.TimeZone
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if r.Retailer == "" && l.retailer == nil {
+			r.Retailer = strings.TrimSpace(line)
+			continue
+		}
+		if !l.parseLine(line, r) {
+			parsed.Unparsed = append(parsed.Unparsed, &ValidationError{
+				Field:   fmt.Sprintf("lines[%d]", i),
+				Code:    CodeUnparsedLine,
+				Message: fmt.Sprintf("could not be parsed: %q", strings.TrimSpace(line)),
+			})
+		}
+	}
+
+	return parsed
+}
+
+/**
+* Reads one line of a receipt into it, returning false if no pattern matched the line. A
+* line can hold both the date and the time.
+ */
+func (l *Layout) parseLine(line string, r *Receipt) bool {
+	if l.retailer != nil && r.Retailer == "" {
+		if retailer, ok := group(l.retailer, line, "retailer"); ok {
+			r.Retailer = strings.TrimSpace(retailer)
+			return true
+		}
+	}
+
+	dated := false
+	if date, ok := group(l.date, line, "date"); ok && r.PurchaseDate == "" {
+		if parsed, ok := parseFormats(date, l.config.DateFormats); ok {
+			r.PurchaseDate, dated = parsed.Format("2006-01-02"), true
+		}
+	}
+	if clock, ok := group(l.time, line, "time"); ok && r.PurchaseTime == "" {
+		if parsed, ok := parseFormats(strings.TrimSpace(clock), l.config.TimeFormats); ok {
+			r.PurchaseTime, dated = parsed.Format("15:04"), true
+		}
+	}
+	if dated {
+		return true
+	}
+
+	amounts := []struct {
+		pattern *regexp.Regexp
+		name    string
+		field   *string
+	}{{l.total, "total", &r.Total}, {l.subtotal, "subtotal", &r.Subtotal}, {l.tax, "tax", &r.Tax}}
+	for _, amount := range amounts {
+		if amount.pattern == nil {
+			continue
+		}
+		if value, ok := group(amount.pattern, line, amount.name); ok {
+			*amount.field = normalizeAmount(value)
+			return true
+		}
+	}
+
+	for _, ignore := range l.ignore {
+		if ignore.MatchString(line) {
+			return true
+		}
+	}
+
+	match := l.item.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+	item := Item{
+		ShortDescription: strings.TrimSpace(match[l.item.SubexpIndex("description")]),
+		Price:            normalizeAmount(match[l.item.SubexpIndex("price")]),
+	}
+	if i := l.item.SubexpIndex("quantity"); i >= 0 && match[i] != "" {
+		item.Quantity, _ = strconv.Atoi(match[i])
+	}
+	if i := l.item.SubexpIndex("unitPrice"); i >= 0 && match[i] != "" {
+		item.UnitPrice = normalizeAmount(match[i])
+	}
+	r.Items = append(r.Items, item)
+
+	return true
+}
+
+// The value of the named group where the pattern matches the line.
+func group(pattern *regexp.Regexp, line string, name string) (string, bool) {
+	match := pattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+
+	return match[pattern.SubexpIndex(name)], true
+}
+
+// Parses the value with the first of the Go time layouts that works.
+func parseFormats(value string, formats []string) (time.Time, bool) {
+	for _, format := range formats {
+		if parsed, err := time.Parse(format, value); err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Writes an amount as printed, like "$1,234.50" or "2.00-", as a receipt amount.
+func normalizeAmount(amount string) string {
+	amount = strings.NewReplacer("$", "", ",", "").Replace(strings.TrimSpace(amount))
+	if strings.HasSuffix(amount, "-") {
+		amount = "-" + strings.TrimSuffix(amount, "-")
+	}
+
+	return amount
+}
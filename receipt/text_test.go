@@ -0,0 +1,119 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+)
+
+const targetText = `
+TARGET
+STORE #1234
+01/01/2022 1:01 PM
+Mountain Dew 12PK           6.49
+Emils Cheese Pizza         12.25
+Knorr Creamy Chicken        1.26
+Doritos Nacho Cheese        3.35
+Klarbrunn 12-PK 12 FL OZ   12.00
+SUBTOTAL                   35.35
+TOTAL                     $35.35
+VISA ****1234              35.35
+%%% 7F 00 1B
+THANK YOU
+`
+
+func TestParseText_ReadsPrintedReceipt(t *testing.T) {
+	parsed, found := ParseText(targetText, DefaultLayouts, "")
+	if !found || parsed.Layout != "us" {
+		t.Fatalf("Invalid layout: %q", parsed.Layout)
+	}
+
+	r := parsed.Receipt
+	if r.Retailer != "TARGET" || r.PurchaseDate != "2022-01-01" || r.PurchaseTime != "13:01" || r.Subtotal != "35.35" || r.Total != "35.35" {
+		t.Errorf("Invalid receipt: %+v", r)
+	}
+	if len(r.Items) != 5 || r.Items[4].ShortDescription != "Klarbrunn 12-PK 12 FL OZ" || r.Items[4].Price != "12.00" {
+		t.Errorf("Invalid items: %+v", r.Items)
+	}
+	if len(parsed.Unparsed) != 1 || parsed.Unparsed[0].Field != "lines[12]" || parsed.Unparsed[0].Code != CodeUnparsedLine {
+		t.Errorf("Invalid unparsed lines: %v", ValidationErrors(parsed.Unparsed))
+	}
+
+	result, err := Score(r)
+	if err != nil || result.Points != 28 {
+		t.Errorf("Expected the points of the JSON receipt, got %d, %v", result.Points, err)
+	}
+}
+
+func TestParseText_KeepsItemsThatStartWithALabel(t *testing.T) {
+	text := strings.Join([]string{
+		"SHOP",
+		"01/01/2022 1:01 PM",
+		"Store Brand Milk           3.00",
+		"Card Game                  5.00",
+		"Credit Card               $8.00",
+		"CHANGE: 0.00",
+		"TOTAL                      8.00",
+	}, "\n")
+
+	parsed, _ := ParseText(text, DefaultLayouts, "us")
+	items := parsed.Receipt.Items
+	if len(items) != 2 || items[0].ShortDescription != "Store Brand Milk" || items[1].ShortDescription != "Card Game" {
+		t.Errorf("Invalid items: %+v", items)
+	}
+	if len(parsed.Unparsed) != 0 {
+		t.Errorf("Invalid unparsed lines: %v", ValidationErrors(parsed.Unparsed))
+	}
+}
+
+func TestParseText_PicksTheLayoutThatFits(t *testing.T) {
+	text := strings.Join([]string{
+		"M&M Corner Market",
+		"2022-03-20 14:33:12",
+		"4 x Gatorade @ 2.25    9.00",
+		"Coupon                 1.00-",
+		"Total                  8.00",
+	}, "\r\n")
+
+	parsed, _ := ParseText(text, DefaultLayouts, "")
+	r := parsed.Receipt
+	if parsed.Layout != "iso" || len(parsed.Unparsed) != 0 || r.PurchaseDate != "2022-03-20" || r.PurchaseTime != "14:33" {
+		t.Fatalf("Invalid parse: %+v", parsed)
+	}
+	gatorade := Item{ShortDescription: "Gatorade", Price: "9.00", Quantity: 4, UnitPrice: "2.25"}
+	if len(r.Items) != 2 || r.Items[0] != gatorade || r.Items[1].Price != "-1.00" {
+		t.Errorf("Invalid items: %+v", r.Items)
+	}
+
+	// The US layout only finds the time.
+	parsed, found := ParseText(text, DefaultLayouts, "us")
+	if !found || parsed.Receipt.PurchaseDate != "" || parsed.Receipt.PurchaseTime != "14:33" {
+		t.Errorf("Expected only the time with the US layout, got %+v", parsed.Receipt)
+	}
+
+	if _, found := ParseText(text, DefaultLayouts, "metric"); found {
+		t.Error("Found a layout that doesn't exist")
+	}
+}
+
+func TestNewLayouts_RejectsInvalidLayouts(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(configs []LayoutConfig)
+	}{
+		{"no name", func(configs []LayoutConfig) { configs[0].Name = "" }},
+		{"same name", func(configs []LayoutConfig) { configs[1].Name = configs[0].Name }},
+		{"no total", func(configs []LayoutConfig) { configs[0].Total = "" }},
+		{"no price group", func(configs []LayoutConfig) { configs[0].Item = `^(?P<description>.*)$` }},
+		{"bad pattern", func(configs []LayoutConfig) { configs[0].Date = `(?P<date>[0-9` }},
+		{"no formats", func(configs []LayoutConfig) { configs[0].TimeFormats = nil }},
+		{"unknown currency", func(configs []LayoutConfig) { configs[0].Currency = "XYZ" }},
+	}
+
+	for _, test := range tests {
+		configs := DefaultLayoutConfigs()
+		test.edit(configs)
+		if _, err := NewLayouts(configs); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
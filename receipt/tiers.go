@@ -0,0 +1,165 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Configures membership tiers. An account's tier is decided by the points it earned, or
+// the amount it spent, on receipts scored in the last WindowMonths months, and its
+// multiplier is applied to the points of every receipt it submits.
+type TierPolicy struct {
+	Basis        string       `json:"basis"`
+	WindowMonths int          `json:"windowMonths"`
+	Tiers        []TierConfig `json:"tiers"`
+}
+
+// A single tier, listed from the lowest to the highest. An account qualifies for the
+// tier once it earned MinPoints (with basis "points") or spent MinSpend (with basis
+// "spend"). The lowest tier must have no minimum.
+type TierConfig struct {
+	Name       string  `json:"name"`
+	Multiplier Decimal `json:"multiplier"`
+	MinPoints  int64   `json:"minPoints,omitempty"`
+	MinSpend   string  `json:"minSpend,omitempty"`
+}
+
+// What a TierPolicy can decide tiers by.
+const (
+	TierBasisPoints = "points"
+	TierBasisSpend  = "spend"
+)
+
+// A receipt that an account had scored, as taken into account for its tier.
+type PastReceipt struct {
+	Receipt  Receipt
+	Points   int64
+	ScoredAt time.Time
+}
+
+// The tier an account qualifies for, what it earned and spent in the window that
+// started at Since, and the tier above, if there is one.
+type Standing struct {
+	Tier   TierConfig  `json:"tier"`
+	Next   *TierConfig `json:"next,omitempty"`
+	Basis  string      `json:"basis"`
+	Points int64       `json:"points"`
+	Spend  string      `json:"spend"`
+	Since  time.Time   `json:"since"`
+}
+
+// A compiled TierPolicy. minimums holds each tier's minimum in points or cents.
+type tierPolicy struct {
+	basis        string
+	windowMonths int
+	tiers        []TierConfig
+	minimums     []int64
+}
+
+/**
+* Checks a tier policy and builds the tierPolicy that applies it.
+ */
+func compileTiers(policy TierPolicy, exponent int) (*tierPolicy, error) {
+	if policy.Basis != TierBasisPoints && policy.Basis != TierBasisSpend {
+		return nil, fmt.Errorf("basis must be %q or %q", TierBasisPoints, TierBasisSpend)
+	}
+	if policy.WindowMonths <= 0 {
+		return nil, errors.New("windowMonths must be positive")
+	}
+	if len(policy.Tiers) == 0 {
+		return nil, errors.New("there must be at least one tier")
+	}
+
+	compiled := &tierPolicy{basis: policy.Basis, windowMonths: policy.WindowMonths, tiers: policy.Tiers}
+	names := map[string]bool{}
+	for i, tier := range policy.Tiers {
+		if tier.Name == "" || names[tier.Name] {
+			return nil, fmt.Errorf("tiers[%d]: name is required and must be unique", i)
+		}
+		names[tier.Name] = true
+		if tier.Multiplier.Cmp(decimalOne) < 0 {
+			return nil, fmt.Errorf("tiers[%d]: multiplier must be at least 1", i)
+		}
+
+		var minimum int64
+		if policy.Basis == TierBasisPoints {
+			if tier.MinSpend != "" {
+				return nil, fmt.Errorf("tiers[%d]: minSpend is only used with the spend basis", i)
+			}
+			minimum = tier.MinPoints
+		} else {
+			if tier.MinPoints != 0 {
+				return nil, fmt.Errorf("tiers[%d]: minPoints is only used with the points basis", i)
+			}
+			if tier.MinSpend != "" && !amountRegexps[exponent].MatchString(tier.MinSpend) {
+				return nil, fmt.Errorf("tiers[%d]: minSpend must be an amount like 500.00", i)
+			}
+			if tier.MinSpend != "" {
+				minimum = int64(parseAmount(tier.MinSpend, exponent))
+			}
+		}
+
+		if i == 0 && minimum != 0 {
+			return nil, errors.New("tiers[0]: the lowest tier must have no minimum")
+		}
+		if i > 0 && minimum <= compiled.minimums[i-1] {
+			return nil, fmt.Errorf("tiers[%d]: minimum must be above the tier before", i)
+		}
+		compiled.minimums = append(compiled.minimums, minimum)
+	}
+
+	return compiled, nil
+}
+
+/**
+* Works out the tier an account qualifies for from the receipts it had scored. Only
+* receipts scored in the window before now count, and spend is in the currency of the
+* rules. The second return value is false if the engine's rule set has no tiers.
+ */
+func (e *Engine) Standing(history []PastReceipt, now time.Time) (Standing, bool) {
+	policy := e.tiers
+	if policy == nil {
+		return Standing{}, false
+	}
+
+	since := now.AddDate(0, -policy.windowMonths, 0)
+	var points int64 = 0
+	var spend Money = 0
+	for _, past := range history {
+		if past.ScoredAt.Before(since) {
+			continue
+		}
+		points += past.Points
+		if priced, err := e.price(past.Receipt); err == nil {
+			spend += priced.total
+		}
+	}
+
+	qualifying := points
+	if policy.basis == TierBasisSpend {
+		qualifying = int64(spend)
+	}
+
+	standing := Standing{Tier: policy.tiers[0], Basis: policy.basis, Points: points, Spend: formatAmount(spend, e.exponent), Since: since}
+	for i, tier := range policy.tiers[1:] {
+		if qualifying < policy.minimums[i+1] {
+			next := tier
+			standing.Next = &next
+			break
+		}
+		standing.Tier = tier
+	}
+
+	return standing, true
+}
+
+/**
+* Applies a tier's multiplier to the result, as a rule of its own that awards the extra
+* points, rounded to the nearest point.
+ */
+func (r *Result) ApplyTier(tier TierConfig) {
+	input := fmt.Sprintf("%s: %sx %d points", tier.Name, tier.Multiplier, r.Points)
+	extra := tier.Multiplier.roundTimes(r.Points) - r.Points
+	r.award(RuleTierMultiplier, extra, input)
+}
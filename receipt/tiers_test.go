@@ -0,0 +1,101 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+)
+
+func tieredEngine(t *testing.T, basis string) *Engine {
+	set := DefaultRuleSet()
+	set.Tiers = &TierPolicy{Basis: basis, WindowMonths: 12, Tiers: []TierConfig{
+		{Name: "bronze", Multiplier: MustParseDecimal("1")},
+		{Name: "silver", Multiplier: MustParseDecimal("1.25"), MinPoints: 100},
+		{Name: "gold", Multiplier: MustParseDecimal("1.5"), MinPoints: 500},
+	}}
+	if basis == TierBasisSpend {
+		set.Tiers.Tiers[1].MinPoints, set.Tiers.Tiers[1].MinSpend = 0, "50.00"
+		set.Tiers.Tiers[2].MinPoints, set.Tiers.Tiers[2].MinSpend = 0, "200.00"
+	}
+
+	engine, err := NewEngine(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return engine
+}
+
+func TestStanding_QualifiesOverTheWindow(t *testing.T) {
+	engine := tieredEngine(t, TierBasisPoints)
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	history := []PastReceipt{
+		{targetReceipt(), 400, now.AddDate(-2, 0, 0)}, // Outside the window.
+		{targetReceipt(), 300, now.AddDate(0, -3, 0)},
+		{targetReceipt(), 250, now.AddDate(0, -1, 0)},
+	}
+
+	standing, found := engine.Standing(history, now)
+	if !found || standing.Tier.Name != "gold" || standing.Points != 550 || standing.Next != nil {
+		t.Errorf("Expected gold with 550 points, got %+v", standing)
+	}
+
+	standing, _ = engine.Standing(history[:2], now)
+	if standing.Tier.Name != "silver" || standing.Next == nil || standing.Next.Name != "gold" {
+		t.Errorf("Expected silver on the way to gold, got %+v", standing)
+	}
+
+	standing, _ = engine.Standing(nil, now)
+	if standing.Tier.Name != "bronze" {
+		t.Errorf("Expected bronze without receipts, got %+v", standing)
+	}
+
+	// Spend is 35.35 per receipt.
+	standing, _ = tieredEngine(t, TierBasisSpend).Standing(history, now)
+	if standing.Tier.Name != "silver" || standing.Spend != "70.70" {
+		t.Errorf("Expected silver with 70.70 spent, got %+v", standing)
+	}
+
+	if _, found := DefaultEngine.Standing(history, now); found {
+		t.Error("The default rules have no tiers")
+	}
+}
+
+func TestApplyTier_ExplainsExtraPoints(t *testing.T) {
+	result, err := Score(targetReceipt())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result.ApplyTier(TierConfig{Name: "gold", Multiplier: MustParseDecimal("1.5")})
+	last := result.Rules[len(result.Rules)-1]
+	if result.Points != 42 || last.Rule != RuleTierMultiplier || last.Points != 14 || last.Input != "gold: 1.5x 28 points" {
+		t.Errorf("Invalid tier result: %+v", result)
+	}
+}
+
+func TestNewEngine_RejectsInvalidTiers(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy TierPolicy
+	}{
+		{"unknown basis", TierPolicy{Basis: "visits", WindowMonths: 12, Tiers: []TierConfig{{Name: "bronze", Multiplier: MustParseDecimal("1")}}}},
+		{"no window", TierPolicy{Basis: TierBasisPoints, Tiers: []TierConfig{{Name: "bronze", Multiplier: MustParseDecimal("1")}}}},
+		{"no tiers", TierPolicy{Basis: TierBasisPoints, WindowMonths: 12}},
+		{"lowest minimum", TierPolicy{Basis: TierBasisPoints, WindowMonths: 12, Tiers: []TierConfig{{Name: "bronze", Multiplier: MustParseDecimal("1"), MinPoints: 10}}}},
+		{"small multiplier", TierPolicy{Basis: TierBasisPoints, WindowMonths: 12, Tiers: []TierConfig{{Name: "bronze", Multiplier: MustParseDecimal("0.5")}}}},
+		{"out of order", TierPolicy{Basis: TierBasisPoints, WindowMonths: 12, Tiers: []TierConfig{
+			{Name: "bronze", Multiplier: MustParseDecimal("1")}, {Name: "gold", Multiplier: MustParseDecimal("1.5"), MinPoints: 500}, {Name: "silver", Multiplier: MustParseDecimal("1.25"), MinPoints: 100},
+		}}},
+		{"wrong minimum", TierPolicy{Basis: TierBasisSpend, WindowMonths: 12, Tiers: []TierConfig{
+			{Name: "bronze", Multiplier: MustParseDecimal("1")}, {Name: "gold", Multiplier: MustParseDecimal("1.5"), MinPoints: 500},
+		}}},
+	}
+
+	for _, test := range tests {
+		set := DefaultRuleSet()
+		set.Tiers = &test.policy
+		if _, err := NewEngine(set); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
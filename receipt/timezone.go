@@ -0,0 +1,128 @@
+package receipt
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	// Time zones are looked up by name, so don't depend on the system having them.
+	_ "time/tzdata"
+)
+
+const timestampPattern = `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`
+
+var timestampRegexp = regexp.MustCompile(timestampPattern)
+
+/**
+* Returns the receipt with its purchase date and time in the local time of the store.
+* They are taken from PurchasedAt, in TimeZone or, without one, in the timestamp's own
+* offset. A receipt without PurchasedAt is already in local time and is returned as it is.
+* The receipt must be valid.
+ */
+func (r Receipt) Localized() Receipt {
+	if r.PurchasedAt == "" {
+		return r
+	}
+
+	local := r.localPurchase()
+	r.PurchaseDate, r.PurchaseTime = local.Format("2006-01-02"), local.Format("15:04")
+	return r
+}
+
+/**
+* Returns the instant of the purchase in UTC. A purchase date and time without PurchasedAt
+* are in TimeZone, or in UTC if the receipt has none. The receipt must be valid.
+ */
+func (r Receipt) PurchaseInstant() time.Time {
+	if r.PurchasedAt != "" {
+		return r.localPurchase().UTC()
+	}
+
+	location := time.UTC
+	if r.TimeZone != "" {
+		location, _ = time.LoadLocation(r.TimeZone)
+	}
+	instant, _ := time.ParseInLocation("2006-01-02 15:04", r.PurchaseDate+" "+r.PurchaseTime, location)
+
+	return instant.UTC()
+}
+
+// The PurchasedAt of a valid receipt, in its TimeZone if it has one.
+func (r Receipt) localPurchase() time.Time {
+	instant, _ := time.Parse(time.RFC3339, r.PurchasedAt)
+	if r.TimeZone != "" {
+		location, _ := time.LoadLocation(r.TimeZone)
+		instant = instant.In(location)
+	}
+
+	return instant
+}
+
+/**
+* Checks the time zone and timestamp of a receipt, and that any purchase date and time it
+* has as well are the local date and time of the timestamp.
+ */
+func checkTimestamp(r Receipt) ValidationErrors {
+	var errs ValidationErrors
+
+	zoneValid := true
+	if r.TimeZone != "" {
+		// LoadLocation also accepts "Local", the zone of the server, which isn't IANA's.
+		if _, err := time.LoadLocation(r.TimeZone); err != nil || r.TimeZone == "Local" {
+			errs = append(errs, invalidValue("timeZone", "must be an IANA time zone like America/Chicago"))
+			zoneValid = false
+		}
+	}
+
+	if r.PurchasedAt == "" {
+		return errs
+	}
+	if !timestampRegexp.MatchString(r.PurchasedAt) {
+		return append(errs, invalidFormat("purchasedAt", timestampPattern))
+	}
+	if _, err := time.Parse(time.RFC3339, r.PurchasedAt); err != nil {
+		return append(errs, invalidValue("purchasedAt", "must be a valid RFC 3339 timestamp"))
+	}
+	if !zoneValid {
+		return errs
+	}
+
+	local := r.Localized()
+	if r.PurchaseDate != "" && r.PurchaseDate != local.PurchaseDate {
+		errs = append(errs, invalidValue("purchaseDate", fmt.Sprintf("must be %s, the local date of purchasedAt", local.PurchaseDate)))
+	}
+	if r.PurchaseTime != "" && r.PurchaseTime != local.PurchaseTime {
+		errs = append(errs, invalidValue("purchaseTime", fmt.Sprintf("must be %s, the local time of purchasedAt", local.PurchaseTime)))
+	}
+
+	return errs
+}
+
+// How far a purchase date and time without a time zone can be ahead of UTC: they are taken
+// to be in UTC, but could be in the earliest time zone, 14 hours ahead.
+const maxZoneOffset = 14 * time.Hour
+
+/**
+* Checks that a valid receipt was not purchased after now, give or take the clock skew,
+* and not more than window before now. A window of zero allows any age. The returned
+* error is a ValidationErrors with the code CodeFutureDate or CodeDateTooOld.
+ */
+func CheckPurchaseDate(r Receipt, now time.Time, skew time.Duration, window time.Duration) error {
+	field := "purchaseDate"
+	if r.PurchasedAt != "" {
+		field = "purchasedAt"
+	}
+	if r.PurchasedAt == "" && r.TimeZone == "" {
+		skew += maxZoneOffset
+	}
+
+	instant := r.PurchaseInstant()
+	if instant.After(now.Add(skew)) {
+		return ValidationErrors{{Field: field, Code: CodeFutureDate, Message: "must not be in the future"}}
+	}
+	if window > 0 && instant.Before(now.Add(-window)) {
+		return ValidationErrors{{Field: field, Code: CodeDateTooOld, Message: fmt.Sprintf("must be within %s of the submission", window)}}
+	}
+
+	return nil
+}
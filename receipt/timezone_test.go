@@ -0,0 +1,73 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore_UsesTheLocalTimeOfTheStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		purchasedAt string
+		timeZone    string
+		points      int64
+	}{
+		{"local time zone", "2022-03-20T21:33:00Z", "America/Los_Angeles", 109},
+		{"offset of the timestamp", "2022-03-20T14:33:00-07:00", "", 109},
+		{"utc", "2022-03-20T21:33:00Z", "", 99},
+		{"next day in utc", "2022-03-21T03:33:00Z", "America/Los_Angeles", 99},
+	}
+
+	for _, test := range tests {
+		r := gatoradeReceipt()
+		r.PurchaseDate, r.PurchaseTime = "", ""
+		r.PurchasedAt, r.TimeZone = test.purchasedAt, test.timeZone
+		result, err := Score(r)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if result.Points != test.points {
+			t.Errorf("%s: expected %d points, got %d", test.name, test.points, result.Points)
+		}
+	}
+}
+
+func TestPurchaseInstant_IsInUTC(t *testing.T) {
+	r := gatoradeReceipt()
+	r.PurchaseDate, r.PurchaseTime, r.TimeZone = "2022-03-21", "01:00", "Asia/Tokyo"
+	if instant := r.PurchaseInstant(); !instant.Equal(time.Date(2022, 3, 20, 16, 0, 0, 0, time.UTC)) || instant.Location() != time.UTC {
+		t.Errorf("Invalid instant in Tokyo: %v", instant)
+	}
+
+	r.PurchaseDate, r.PurchaseTime, r.TimeZone = "", "", ""
+	r.PurchasedAt = "2022-03-20T14:33:00-07:00"
+	if instant := r.PurchaseInstant(); !instant.Equal(time.Date(2022, 3, 20, 21, 33, 0, 0, time.UTC)) {
+		t.Errorf("Invalid instant of the timestamp: %v", instant)
+	}
+}
+
+func TestScore_ValidatesTimestamps(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(r *Receipt)
+		field string
+		code  string
+	}{
+		{"unknown zone", func(r *Receipt) { r.TimeZone = "Mars/Olympus" }, "timeZone", CodeInvalidValue},
+		{"server zone", func(r *Receipt) { r.TimeZone = "Local" }, "timeZone", CodeInvalidValue},
+		{"no timestamp or date", func(r *Receipt) { r.PurchaseDate = "" }, "purchaseDate", CodeMissing},
+		{"malformed timestamp", func(r *Receipt) { r.PurchasedAt = "2022-03-20 14:33" }, "purchasedAt", CodeInvalidFormat},
+		{"impossible timestamp", func(r *Receipt) { r.PurchasedAt = "2022-03-20T25:33:00Z" }, "purchasedAt", CodeInvalidValue},
+		{"other date", func(r *Receipt) { r.PurchasedAt, r.TimeZone = "2022-03-21T14:33:00Z", "UTC" }, "purchaseDate", CodeInvalidValue},
+		{"other time", func(r *Receipt) { r.PurchasedAt = "2022-03-20T14:33:00+01:00"; r.PurchaseTime = "13:33" }, "purchaseTime", CodeInvalidValue},
+	}
+
+	for _, test := range tests {
+		r := gatoradeReceipt()
+		test.edit(&r)
+		_, err := Score(r)
+		errs, ok := err.(ValidationErrors)
+		if !ok || len(errs) != 1 || errs[0].Field != test.field || errs[0].Code != test.code {
+			t.Errorf("%s: expected %s on %s, got %v", test.name, test.code, test.field, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package receipt
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Amounts have at most 12 digits, so that a sum of them can't overflow a Money.
+const (
+	amountPattern = `^[0-9]{1,10}\.[0-9][0-9]$`
+	datePattern   = `^\d{4}\-(0[1-9]|1[012])\-(0[1-9]|[12][0-9]|3[01])$`
+	timePattern   = `^([01]\d|2[0-3]):([0-5]\d)$`
+	upcPattern    = `^[0-9]{12}$`
+)
+
+// The largest quantity of an item. With it, a quantity times an amount can't overflow a
+// Money either.
+const maxQuantity = 1000000
+
+var (
+	amountRegexp = regexp.MustCompile(amountPattern)
+	dateRegexp   = regexp.MustCompile(datePattern)
+	timeRegexp   = regexp.MustCompile(timePattern)
+	upcRegexp    = regexp.MustCompile(upcPattern)
+)
+
+// Checks that every field is present and well formed, so the rules can assume it. The
+// amounts must have the decimal places of the receipt's currency, or of the default
+// currency if it has none. A sale can't have a negative total, and a return can't have
+// positive amounts. Every problem is collected rather than stopping at the first one.
+func validate(r Receipt, defaultCurrency string) error {
+	var errs ValidationErrors
+
+	currency := r.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	exponent, found := currencyExponents[currency]
+	if !found {
+		if !currencyRegexp.MatchString(currency) {
+			errs = append(errs, invalidFormat("currency", currencyPattern))
+		} else {
+			errs = append(errs, &ValidationError{Field: "currency", Code: CodeUnknownCurrency, Message: "is not a supported currency"})
+		}
+		exponent = 2
+	}
+	amountRegexp, amountPattern := signedAmountRegexps[exponent], signedAmountPatterns[exponent]
+
+	checkRequired := func(field string, value string, pattern *regexp.Regexp, source string) {
+		if value == "" {
+			errs = append(errs, missing(field))
+		} else if !pattern.MatchString(value) {
+			errs = append(errs, invalidFormat(field, source))
+		}
+	}
+
+	if r.Retailer == "" {
+		errs = append(errs, missing("retailer"))
+	}
+	// A timestamp stands in for the date and time.
+	if r.PurchasedAt == "" || r.PurchaseDate != "" {
+		checkRequired("purchaseDate", r.PurchaseDate, dateRegexp, datePattern)
+		if dateRegexp.MatchString(r.PurchaseDate) && !calendarDate(r.PurchaseDate) {
+			errs = append(errs, invalidDate("purchaseDate"))
+		}
+	}
+	if r.PurchasedAt == "" || r.PurchaseTime != "" {
+		checkRequired("purchaseTime", r.PurchaseTime, timeRegexp, timePattern)
+	}
+	errs = append(errs, checkTimestamp(r)...)
+	checkRequired("total", r.Total, amountRegexp, amountPattern)
+	if r.Subtotal != "" {
+		checkRequired("subtotal", r.Subtotal, amountRegexp, amountPattern)
+	}
+	if r.Tax != "" {
+		checkRequired("tax", r.Tax, amountRegexp, amountPattern)
+	}
+
+	if len(r.Items) == 0 {
+		errs = append(errs, &ValidationError{Field: "items", Code: CodeNoItems, Message: "must contain at least one item"})
+	}
+	for i, item := range r.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		if item.ShortDescription == "" {
+			errs = append(errs, missing(field+".shortDescription"))
+		}
+		checkRequired(field+".price", item.Price, amountRegexp, amountPattern)
+		if r.kind() == ReceiptReturn && amountRegexp.MatchString(item.Price) && parseAmount(item.Price, exponent) > 0 {
+			errs = append(errs, invalidValue(field+".price", "must not be positive on a return"))
+		}
+
+		if item.Quantity < 0 {
+			errs = append(errs, invalidValue(field+".quantity", "must be positive"))
+		} else if item.Quantity > maxQuantity {
+			errs = append(errs, invalidValue(field+".quantity", fmt.Sprintf("must be at most %d", maxQuantity)))
+		}
+		if item.UnitPrice != "" {
+			checkRequired(field+".unitPrice", item.UnitPrice, amountRegexp, amountPattern)
+		}
+		if item.Quantity >= 0 && item.Quantity <= maxQuantity && amountRegexp.MatchString(item.UnitPrice) && amountRegexp.MatchString(item.Price) {
+			unit, price, count := parseAmount(item.UnitPrice, exponent), parseAmount(item.Price, exponent), Money(item.count())
+			// Dividing rather than multiplying can't overflow, however large the amounts.
+			matches := price == 0 && unit == 0
+			if unit != 0 {
+				matches = price%unit == 0 && price/unit == count
+			}
+			if !matches {
+				expected := unit * count
+				errs = append(errs, &ValidationError{
+					Field:   field + ".price",
+					Code:    CodePriceMismatch,
+					Message: fmt.Sprintf("%d at %s is %s, not %s", item.count(), item.UnitPrice, formatAmount(expected, exponent), item.Price),
+				})
+			}
+		}
+		if item.UPC != "" {
+			if !upcRegexp.MatchString(item.UPC) {
+				errs = append(errs, invalidFormat(field+".upc", upcPattern))
+			} else if !validCheckDigit(item.UPC) {
+				errs = append(errs, invalidValue(field+".upc", "has the wrong check digit"))
+			}
+		}
+	}
+
+	switch r.kind() {
+	case ReceiptSale:
+		if r.OriginalReceiptId != "" {
+			errs = append(errs, invalidValue("originalReceiptId", "is only allowed on a return or exchange"))
+		}
+		if amountRegexp.MatchString(r.Total) && parseAmount(r.Total, exponent) < 0 {
+			errs = append(errs, invalidValue("total", "must not be negative on a sale"))
+		}
+	case ReceiptReturn:
+		if amountRegexp.MatchString(r.Total) && parseAmount(r.Total, exponent) > 0 {
+			errs = append(errs, invalidValue("total", "must not be positive on a return"))
+		}
+	case ReceiptExchange:
+	default:
+		errs = append(errs, invalidValue("type", fmt.Sprintf("must be %q, %q or %q", ReceiptSale, ReceiptReturn, ReceiptExchange)))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Whether a date that matched datePattern is a day of the calendar, so not, say, Feb 30.
+func calendarDate(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+// Checks the last digit of a code that matched upcPattern against the others: three times
+// the digits in odd positions plus the digits in even positions must be a multiple of 10.
+func validCheckDigit(upc string) bool {
+	sum := 0
+	for i, c := range upc {
+		digit := int(c - '0')
+		if i%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	return sum%10 == 0
+}
+
+// Converts a time that matched timePattern to minutes after midnight.
+func parseMinutes(time string) int {
+	splitTime := strings.Split(time, ":")
+	hour, _ := strconv.Atoi(splitTime[0])
+	minute, _ := strconv.Atoi(splitTime[1])
+
+	return hour*60 + minute
+}
+
+// Returns the day of the month of a date that matched datePattern.
+func parseDay(date string) int {
+	day, _ := strconv.Atoi(strings.Split(date, "-")[2])
+
+	return day
+}
@@ -0,0 +1,65 @@
+/**
+* This file contains returns and exchanges. One that names the receipt its items were
+* bought on takes back the points those items earned, from the same account.
+ */
+
+package main
+
+import (
+	"danielHett/main/receipt"
+)
+
+// The code of the error for a return whose originalReceiptId is not a stored receipt.
+const UnknownReceiptCode = "unknown_receipt"
+
+/**
+* Works out the points a return or exchange takes back from its original receipt, under
+* the rules and the tier the original was scored with, taking into account the returns
+* already made against it. The request gets the original's account if it has none, and
+* must not name another. The returned rules are marked with the original's id.
+ */
+func clawBack(store Store, rulebook *receipt.Rulebook, request *ProcessRequest) (receipt.Result, error) {
+	r := request.Receipt
+	original, err := store.GetReceipt(r.OriginalReceiptId)
+	if err != nil || original.DuplicateOf != "" {
+		return receipt.Result{}, receipt.ValidationErrors{{Field: "originalReceiptId", Code: UnknownReceiptCode, Message: ReceiptNotFoundResponse}}
+	}
+	if original.Receipt.Type == receipt.ReceiptReturn {
+		return receipt.Result{}, receipt.ValidationErrors{{Field: "originalReceiptId", Code: receipt.CodeInvalidValue, Message: "must be a sale or an exchange"}}
+	}
+
+	if request.AccountId == "" {
+		request.AccountId = original.AccountId
+	} else if request.AccountId != original.AccountId {
+		return receipt.Result{}, receipt.ValidationErrors{{Field: "accountId", Code: receipt.CodeInvalidValue, Message: "must be the account of the original receipt"}}
+	}
+
+	engine, found := rulebook.Engine(original.RuleSet)
+	if !found {
+		engine = rulebook.Current()
+	}
+
+	returns, err := store.GetReturns(original.Id)
+	if err != nil {
+		return receipt.Result{}, err
+	}
+	var earlier []receipt.Receipt
+	for _, past := range returns {
+		if past.DuplicateOf == "" {
+			earlier = append(earlier, past.Receipt)
+		}
+	}
+
+	result, err := engine.ClawBack(original.Receipt, earlier, r)
+	if err != nil {
+		return receipt.Result{}, err
+	}
+	if original.Tier != nil {
+		result.ApplyTier(*original.Tier)
+	}
+	for i := range result.Rules {
+		result.Rules[i].ReturnedFrom = original.Id
+	}
+
+	return result, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"danielHett/main/receipt"
+)
+
+func processRequest(store Store, request ProcessRequest) (int, []byte) {
+	body, _ := json.Marshal(request)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	processHandler(store, testRulebook, defaultConfig, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	return w.Result().StatusCode, data
+}
+
+func pizzaReturn(originalId string, time string) ProcessRequest {
+	return ProcessRequest{Receipt: receipt.Receipt{
+		Retailer:          "Target",
+		PurchaseDate:      "2022-01-05",
+		PurchaseTime:      time,
+		Items:             []receipt.Item{{ShortDescription: "Emils Cheese Pizza", Price: "-12.25"}},
+		Total:             "-12.25",
+		Type:              receipt.ReceiptReturn,
+		OriginalReceiptId: originalId,
+	}}
+}
+
+// Processes the challenge's Target receipt for the account and returns its id. It earns
+// 28 points, 3 of them for the pizza.
+func processTargetSale(t *testing.T, store Store, accountId string) string {
+	status, data := processRequest(store, ProcessRequest{Receipt: receipt.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []receipt.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}, AccountId: accountId})
+	if status != 200 {
+		t.Fatalf("Could not process the sale: %s", data)
+	}
+	var original ProcessResponse
+	json.Unmarshal(data, &original)
+	return original.Id
+}
+
+func TestReturns_ClawBackPointsFromTheAccount(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	originalId := processTargetSale(t, testStore, accountId)
+
+	status, data := processRequest(testStore, pizzaReturn(originalId, "10:00"))
+	if status != 200 {
+		t.Fatalf("Could not process the return: %s", data)
+	}
+	var returned ProcessResponse
+	json.Unmarshal(data, &returned)
+
+	if balance := getBalance(testStore, accountId); balance != 25 {
+		t.Errorf("Invalid balance after the return: %d", balance)
+	}
+	stored, _ := testStore.GetReceipt(returned.Id)
+	if stored.Points != -3 || stored.Rules[0].ReturnedFrom != originalId || stored.AccountId != accountId {
+		t.Errorf("Invalid return: %+v", stored)
+	}
+
+	// The pizza can only be returned once.
+	status, data = processRequest(testStore, pizzaReturn(originalId, "11:00"))
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	if status != 400 || len(problem.Errors) != 1 || problem.Errors[0].Code != receipt.CodeNotOnOriginal {
+		t.Errorf("Expected not_on_original, got %d %s", status, data)
+	}
+}
+
+func TestReturns_RefusesUnknownOriginal(t *testing.T) {
+	testStore := newMemStore()
+
+	status, data := processRequest(testStore, pizzaReturn("59a8c4b7-3a8e-4b7e-9f2d-2c4e8f1d0a6b", "10:00"))
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	if status != 400 || len(problem.Errors) != 1 || problem.Errors[0].Code != UnknownReceiptCode {
+		t.Errorf("Expected unknown_receipt, got %d %s", status, data)
+	}
+
+	// A return that names no original is accepted, and earns nothing.
+	status, data = processRequest(testStore, pizzaReturn("", "10:00"))
+	var response ProcessResponse
+	json.Unmarshal(data, &response)
+	if stored, err := testStore.GetReceipt(response.Id); status != 200 || err != nil || stored.Points != 0 {
+		t.Errorf("Invalid return without an original: %d %s", status, data)
+	}
+}
+
+func TestReturns_OnceWithinABatch(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	originalId := processTargetSale(t, testStore, accountId)
+
+	first, _ := json.Marshal(pizzaReturn(originalId, "10:00"))
+	second, _ := json.Marshal(pizzaReturn(originalId, "11:00"))
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process:batch", bytes.NewReader([]byte("["+string(first)+","+string(second)+"]")))
+	w := httptest.NewRecorder()
+	batchHandler(testStore, testRulebook, defaultConfig, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	var batchResponse BatchResponse
+	json.Unmarshal(data, &batchResponse)
+
+	refused := 0
+	for _, result := range batchResponse.Results {
+		if result.Error != nil && len(result.Error.Errors) == 1 && result.Error.Errors[0].Code == receipt.CodeNotOnOriginal {
+			refused++
+		}
+	}
+	if len(batchResponse.Results) != 2 || refused != 1 {
+		t.Errorf("Expected one of the returns to be refused: %s", data)
+	}
+	if balance := getBalance(testStore, accountId); balance != 25 {
+		t.Errorf("Invalid balance after the returns: %d", balance)
+	}
+}
+
+func TestReturns_OnceWhenScoredTogether(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	originalId := processTargetSale(t, testStore, accountId)
+
+	// Both are scored before either is stored, as concurrent requests would be.
+	var scored []*StoredReceipt
+	for _, time := range []string{"10:00", "11:00"} {
+		stored, err := scoreReceipt(testStore, testRulebook, defaultConfig, pizzaReturn(originalId, time), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scored = append(scored, stored)
+	}
+
+	if err := testStore.InsertReceipt(scored[0]); err != nil {
+		t.Fatal(err)
+	}
+	var errs receipt.ValidationErrors
+	if err := testStore.InsertReceipt(scored[1]); !errors.As(err, &errs) || errs[0].Code != receipt.CodeNotOnOriginal {
+		t.Errorf("Expected not_on_original, got %v", err)
+	}
+	if balance := getBalance(testStore, accountId); balance != 25 {
+		t.Errorf("Invalid balance after the returns: %d", balance)
+	}
+}
+
+func TestReturns_EvenExchangeEarnsNothing(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+	originalId := processTargetSale(t, testStore, accountId)
+
+	// On an odd day in the afternoon, so a sale would earn the day and time rules.
+	status, data := processRequest(testStore, ProcessRequest{Receipt: receipt.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-05",
+		PurchaseTime: "14:30",
+		Items: []receipt.Item{
+			{ShortDescription: "Emils Cheese Pizza", Price: "-12.25"},
+			{ShortDescription: "Emils Veggie Pizza", Price: "12.25"},
+		},
+		Total:             "0.00",
+		Type:              receipt.ReceiptExchange,
+		OriginalReceiptId: originalId,
+	}})
+	if status != 200 {
+		t.Fatalf("Could not process the exchange: %s", data)
+	}
+
+	if balance := getBalance(testStore, accountId); balance != 28 {
+		t.Errorf("Expected the exchange to earn nothing net, but the balance is %d", balance)
+	}
+}
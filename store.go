@@ -0,0 +1,816 @@
+/**
+* This file contains the storage used by the handlers. The handlers only see the Store
+* interface, so the in-memory DB can be swapped for the on-disk one in filestore.go at
+* startup.
+ */
+
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-memdb"
+)
+
+// Returned by a Store when nothing is stored under the requested id.
+var ErrNotFound = errors.New("not found")
+
+// Returned by a Store when a receipt is inserted for an account that is not stored.
+var ErrUnknownAccount = errors.New("unknown account")
+
+// Returned by a Store when a redemption is larger than the account's balance.
+var ErrInsufficientPoints = errors.New("insufficient points")
+
+// Returned by a Store when a retailer is inserted with a name that is already a name of
+// another retailer in the catalog.
+var ErrRetailerExists = errors.New("retailer exists")
+
+// Returned by a Store when a receipt with the same fingerprint is already stored, unless
+// the new receipt's DuplicateOf says it is a known duplicate of that receipt.
+type DuplicateError struct {
+	OriginalId string
+}
+
+func (e *DuplicateError) Error() string {
+	return "duplicate of receipt " + e.OriginalId
+}
+
+// Storage for processed receipts.
+type Store interface {
+	InsertReceipt(stored *StoredReceipt) error
+	GetReceipt(id string) (*StoredReceipt, error)
+
+	// Inserts the receipts in one transaction. Receipts that fail with a *DuplicateError,
+	// ErrUnknownAccount or a receipt.ValidationErrors are left out and their error is set
+	// at the same index of the returned slice; any other error fails the whole
+	// transaction.
+	InsertReceipts(stored []*StoredReceipt) ([]error, error)
+
+	InsertAccount(account *Account) error
+	GetAccount(id string) (*Account, error)
+
+	// The receipts attached to the account, oldest first.
+	GetAccountReceipts(accountId string) ([]*StoredReceipt, error)
+
+	// The returns and exchanges that name the receipt as their original, oldest first.
+	GetReturns(receiptId string) ([]*StoredReceipt, error)
+
+	// The ledger entries of the account, oldest first.
+	GetLedger(accountId string) ([]*LedgerEntry, error)
+	InsertLedgerEntry(entry *LedgerEntry) error
+
+	// Inserts a debit entry, unless it would take the account's balance below zero, in
+	// which case ErrInsufficientPoints is returned. The check and the insert happen in
+	// one transaction, so concurrent redemptions can't overdraw the account.
+	Redeem(entry *LedgerEntry) error
+
+	// Inserts an expiry entry for every credit that expired by now and still has
+	// unspent points. Returns the expiry entries that were inserted.
+	ExpireCredits(now time.Time) ([]*LedgerEntry, error)
+
+	// The retailer catalog. InsertRetailer returns ErrRetailerExists if one of the names of
+	// the retailer is already in the catalog, compared with receipt.NormalizeRetailer.
+	// MergeRetailers moves the names and receipts of the retailers with the given ids to the
+	// target retailer and removes them from the catalog, or returns ErrNotFound if any of
+	// them is not stored.
+	InsertRetailer(retailer *Retailer) error
+	GetRetailer(id string) (*Retailer, error)
+	GetRetailers() ([]*Retailer, error)
+	GetRetailerReceipts(retailerId string) ([]*StoredReceipt, error)
+	MergeRetailers(targetId string, retailerIds []string) (*Retailer, error)
+
+	// Inserts the campaign, or replaces the one with the same id.
+	PutCampaign(campaign *receipt.Campaign) error
+	GetCampaign(id string) (*receipt.Campaign, error)
+	GetCampaigns() ([]*receipt.Campaign, error)
+	DeleteCampaign(id string) error
+
+	// Inserts the receipt together with the record of the idempotency key it was sent
+	// with. If an unexpired record for the key already exists, nothing is inserted and
+	// that record is returned instead.
+	InsertReceiptWithKey(stored *StoredReceipt, record *IdempotencyRecord, window time.Duration) (*IdempotencyRecord, error)
+	GetIdempotencyRecord(key string) (*IdempotencyRecord, error)
+
+	Close() error
+}
+
+// Maps every table in the schema to the type of the objects stored in it. The on-disk
+// store uses this to decode the objects it replays on startup.
+var tableTypes = map[string]func() interface{}{
+	"receipt":     func() interface{} { return new(StoredReceipt) },
+	"idempotency": func() interface{} { return new(IdempotencyRecord) },
+	"account":     func() interface{} { return new(Account) },
+	"ledger":      func() interface{} { return new(LedgerEntry) },
+	"campaign":    func() interface{} { return new(receipt.Campaign) },
+	"retailer":    func() interface{} { return new(Retailer) },
+}
+
+/**
+* Creates a new instance of the database for the receipt processor.
+ */
+func createDB() *memdb.MemDB {
+	var schema = &memdb.DBSchema{
+		Tables: map[string]*memdb.TableSchema{
+			"receipt": &memdb.TableSchema{
+				Name: "receipt",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+					"points": &memdb.IndexSchema{
+						Name:    "points",
+						Unique:  false,
+						Indexer: &memdb.IntFieldIndex{Field: "Points"},
+					},
+					"fingerprint": &memdb.IndexSchema{
+						Name:         "fingerprint",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "Fingerprint"},
+					},
+					"account": &memdb.IndexSchema{
+						Name:         "account",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "AccountId"},
+					},
+					"retailer": &memdb.IndexSchema{
+						Name:         "retailer",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "RetailerId"},
+					},
+					"return": &memdb.IndexSchema{
+						Name:         "return",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "ReturnOf"},
+					},
+				},
+			},
+			"account": &memdb.TableSchema{
+				Name: "account",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+				},
+			},
+			"ledger": &memdb.TableSchema{
+				Name: "ledger",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+					"account": &memdb.IndexSchema{
+						Name:    "account",
+						Unique:  false,
+						Indexer: &memdb.UUIDFieldIndex{Field: "AccountId"},
+					},
+				},
+			},
+			"retailer": &memdb.TableSchema{
+				Name: "retailer",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+				},
+			},
+			"campaign": &memdb.TableSchema{
+				Name: "campaign",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
+					},
+				},
+			},
+			"idempotency": &memdb.TableSchema{
+				Name: "idempotency",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Key"},
+					},
+				},
+			},
+		},
+	}
+
+	db, err := memdb.NewMemDB(schema)
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+// A Store that keeps everything in memory. Its contents are lost when the process exits.
+type memStore struct {
+	db *memdb.MemDB
+
+	// Called with the changes of every write transaction before it is committed. If it
+	// returns an error the transaction is aborted. Nil for a purely in-memory store.
+	journal func(changes memdb.Changes) error
+}
+
+/**
+* Creates an empty in-memory store.
+ */
+func newMemStore() *memStore {
+	return &memStore{db: createDB()}
+}
+
+/**
+* Runs fn in a write transaction. The transaction is committed only if fn and the
+* journal both succeed.
+ */
+func (s *memStore) update(fn func(txn *memdb.Txn) error) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+	if s.journal != nil {
+		txn.TrackChanges()
+	}
+
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	if s.journal != nil {
+		if err := s.journal(txn.Changes()); err != nil {
+			return err
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
+/**
+* Inserts a receipt in the transaction, unless its account is not stored, or another
+* receipt with the same fingerprint is already stored and the new one is not marked as
+* its duplicate, or it returns items that its original receipt doesn't have left. A
+* receipt with an account is held to the caps of its campaigns and credits its points to
+* the account's ledger, except for duplicates, or if it took back more points than it
+* earned, posts a claw back that never expires.
+ */
+func insertReceipt(txn *memdb.Txn, stored *StoredReceipt) error {
+	if stored.AccountId != "" {
+		raw, err := txn.First("account", "id", stored.AccountId)
+		if err != nil || raw == nil {
+			return ErrUnknownAccount
+		}
+	}
+
+	if stored.Fingerprint != "" && stored.DuplicateOf == "" {
+		raw, err := txn.First("receipt", "fingerprint", stored.Fingerprint)
+		if err != nil {
+			return err
+		}
+		if raw != nil {
+			return &DuplicateError{OriginalId: raw.(*StoredReceipt).Id}
+		}
+	}
+
+	if stored.ReturnOf != "" && stored.DuplicateOf == "" {
+		if err := checkReturnable(txn, stored); err != nil {
+			return err
+		}
+	}
+
+	if stored.AccountId != "" && stored.DuplicateOf == "" {
+		if err := capCampaigns(txn, stored); err != nil {
+			return err
+		}
+
+		entry := &LedgerEntry{
+			Id:        uuid.New().String(),
+			AccountId: stored.AccountId,
+			Kind:      LedgerCredit,
+			Points:    stored.Points,
+			Reason:    "receipt",
+			ReceiptId: stored.Id,
+			CreatedAt: stored.ProcessedAt,
+			ExpiresAt: stored.ExpiresAt,
+		}
+		if entry.Points < 0 {
+			entry.Kind, entry.Reason, entry.ExpiresAt = LedgerClawback, "return", time.Time{}
+		}
+		if err := txn.Insert("ledger", entry); err != nil {
+			return err
+		}
+	}
+
+	return txn.Insert("receipt", stored)
+}
+
+/**
+* Checks a return or exchange against its original receipt and the returns of it in the
+* transaction, so that two returns of the same item can't both be stored, even if they
+* were scored at the same time. If it returns items that are not left, the returned error
+* is a receipt.ValidationErrors.
+ */
+func checkReturnable(txn *memdb.Txn, stored *StoredReceipt) error {
+	raw, err := txn.First("receipt", "id", stored.ReturnOf)
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return ErrNotFound
+	}
+
+	returns, err := returnsOf(txn, stored.ReturnOf)
+	if err != nil {
+		return err
+	}
+	var earlier []receipt.Receipt
+	for _, past := range returns {
+		if past.DuplicateOf == "" {
+			earlier = append(earlier, past.Receipt)
+		}
+	}
+
+	// Receipts stored before their currency was recorded are in the one they name, or the
+	// default one.
+	original := raw.(*StoredReceipt)
+	currency := original.Currency
+	if currency == "" {
+		currency = original.Receipt.Currency
+	}
+	if currency == "" {
+		currency = receipt.DefaultCurrency
+	}
+
+	return receipt.CheckReturnable(original.Receipt, earlier, stored.Receipt, currency)
+}
+
+/**
+* Takes off the campaign points of a receipt that are over the caps of their campaigns,
+* given what the campaigns awarded to the account's receipts in the transaction. The
+* receipt was scored against the receipts stored at the time, so this keeps receipts
+* scored at the same time from earning more than a cap between them. If any points are
+* taken off, the tier multiplier is applied again to the points that are left.
+ */
+func capCampaigns(txn *memdb.Txn, stored *StoredReceipt) error {
+	it, err := txn.Get("receipt", "account", stored.AccountId)
+	if err != nil {
+		return err
+	}
+	var history []*StoredReceipt
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		history = append(history, raw.(*StoredReceipt))
+	}
+	earned := campaignEarnings(history)
+
+	// The rules are rebuilt in the order scoreReceipt adds them.
+	capped := false
+	result := receipt.Result{Rules: []receipt.RuleResult{}}
+	var returned []receipt.RuleResult
+	for _, rule := range stored.Rules {
+		if rule.ReturnedFrom != "" {
+			returned = append(returned, rule)
+			continue
+		}
+		if rule.Rule == receipt.RuleTierMultiplier {
+			continue
+		}
+		if rule.Campaign != "" {
+			raw, err := txn.First("campaign", "id", rule.Campaign)
+			if err != nil {
+				return err
+			}
+			if raw != nil {
+				limit := raw.(*receipt.Campaign).AccountCap
+				if limit != 0 && rule.Points > limit-earned[rule.Campaign] {
+					rule.Points, capped = limit-earned[rule.Campaign], true
+				}
+			}
+			if rule.Points <= 0 {
+				continue
+			}
+		}
+		result.Points += rule.Points
+		result.Rules = append(result.Rules, rule)
+	}
+	if !capped {
+		return nil
+	}
+
+	if stored.Tier != nil {
+		result.ApplyTier(*stored.Tier)
+	}
+	for _, rule := range returned {
+		result.Points += rule.Points
+		result.Rules = append(result.Rules, rule)
+	}
+	stored.Points, stored.Rules = result.Points, result.Rules
+
+	return nil
+}
+
+func (s *memStore) InsertReceipt(stored *StoredReceipt) error {
+	return s.update(func(txn *memdb.Txn) error {
+		return insertReceipt(txn, stored)
+	})
+}
+
+func (s *memStore) InsertReceipts(stored []*StoredReceipt) ([]error, error) {
+	refused := make([]error, len(stored))
+	err := s.update(func(txn *memdb.Txn) error {
+		for i := range stored {
+			err := insertReceipt(txn, stored[i])
+			var duplicate *DuplicateError
+			var invalid receipt.ValidationErrors
+			if errors.As(err, &duplicate) || errors.Is(err, ErrUnknownAccount) || errors.As(err, &invalid) {
+				refused[i] = err
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refused, nil
+}
+
+func (s *memStore) GetReceipt(id string) (*StoredReceipt, error) {
+	txn := s.db.Txn(false)
+	raw, err := txn.First("receipt", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+
+	return raw.(*StoredReceipt), nil
+}
+
+func (s *memStore) InsertReceiptWithKey(stored *StoredReceipt, record *IdempotencyRecord, window time.Duration) (*IdempotencyRecord, error) {
+	var existing *IdempotencyRecord
+	err := s.update(func(txn *memdb.Txn) error {
+		raw, err := txn.First("idempotency", "id", record.Key)
+		if err != nil {
+			return err
+		}
+		if raw != nil && !raw.(*IdempotencyRecord).Expired(window) {
+			existing = raw.(*IdempotencyRecord)
+			return nil
+		}
+
+		// An expired record is replaced by the new one.
+		if err := insertReceipt(txn, stored); err != nil {
+			return err
+		}
+		return txn.Insert("idempotency", record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+func (s *memStore) GetIdempotencyRecord(key string) (*IdempotencyRecord, error) {
+	txn := s.db.Txn(false)
+	raw, err := txn.First("idempotency", "id", key)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+
+	return raw.(*IdempotencyRecord), nil
+}
+
+func (s *memStore) InsertAccount(account *Account) error {
+	return s.update(func(txn *memdb.Txn) error {
+		return txn.Insert("account", account)
+	})
+}
+
+func (s *memStore) GetAccount(id string) (*Account, error) {
+	txn := s.db.Txn(false)
+	raw, err := txn.First("account", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+
+	return raw.(*Account), nil
+}
+
+func (s *memStore) GetAccountReceipts(accountId string) ([]*StoredReceipt, error) {
+	txn := s.db.Txn(false)
+	it, err := txn.Get("receipt", "account", accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipts []*StoredReceipt
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		receipts = append(receipts, raw.(*StoredReceipt))
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].ProcessedAt.Before(receipts[j].ProcessedAt)
+	})
+
+	return receipts, nil
+}
+
+func (s *memStore) GetReturns(receiptId string) ([]*StoredReceipt, error) {
+	return returnsOf(s.db.Txn(false), receiptId)
+}
+
+// Reads the returns and exchanges of a receipt in the transaction, oldest first.
+func returnsOf(txn *memdb.Txn, receiptId string) ([]*StoredReceipt, error) {
+	it, err := txn.Get("receipt", "return", receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipts []*StoredReceipt
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		receipts = append(receipts, raw.(*StoredReceipt))
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].ProcessedAt.Before(receipts[j].ProcessedAt)
+	})
+
+	return receipts, nil
+}
+
+// Reads the ledger entries of an account in the transaction, oldest first.
+func ledgerEntries(txn *memdb.Txn, accountId string) ([]*LedgerEntry, error) {
+	it, err := txn.Get("ledger", "account", accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*LedgerEntry
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		entries = append(entries, raw.(*LedgerEntry))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+func (s *memStore) GetLedger(accountId string) ([]*LedgerEntry, error) {
+	return ledgerEntries(s.db.Txn(false), accountId)
+}
+
+func (s *memStore) InsertLedgerEntry(entry *LedgerEntry) error {
+	return s.update(func(txn *memdb.Txn) error {
+		return txn.Insert("ledger", entry)
+	})
+}
+
+func (s *memStore) Redeem(entry *LedgerEntry) error {
+	return s.update(func(txn *memdb.Txn) error {
+		entries, err := ledgerEntries(txn, entry.AccountId)
+		if err != nil {
+			return err
+		}
+		if balance(entries)+entry.Points < 0 {
+			return ErrInsufficientPoints
+		}
+
+		return txn.Insert("ledger", entry)
+	})
+}
+
+func (s *memStore) ExpireCredits(now time.Time) ([]*LedgerEntry, error) {
+	var expiries []*LedgerEntry
+	err := s.update(func(txn *memdb.Txn) error {
+		accounts, err := txn.Get("account", "id")
+		if err != nil {
+			return err
+		}
+
+		for raw := accounts.Next(); raw != nil; raw = accounts.Next() {
+			entries, err := ledgerEntries(txn, raw.(*Account).Id)
+			if err != nil {
+				return err
+			}
+
+			for _, expiry := range expiredCredits(entries, now) {
+				if err := txn.Insert("ledger", expiry); err != nil {
+					return err
+				}
+				expiries = append(expiries, expiry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expiries, nil
+}
+
+func (s *memStore) InsertRetailer(retailer *Retailer) error {
+	return s.update(func(txn *memdb.Txn) error {
+		// Every name must be new, or it would be ambiguous which retailer it matches. The
+		// catalog is read in the same transaction, so two retailers sent at the same time
+		// can't both take a name.
+		keys := map[string]bool{}
+		for _, name := range append([]string{retailer.Name}, retailer.Aliases...) {
+			keys[receipt.NormalizeRetailer(name)] = true
+		}
+
+		it, err := txn.Get("retailer", "id")
+		if err != nil {
+			return err
+		}
+		for raw := it.Next(); raw != nil; raw = it.Next() {
+			existing := raw.(*Retailer)
+			for _, name := range append([]string{existing.Name}, existing.Aliases...) {
+				if keys[receipt.NormalizeRetailer(name)] {
+					return ErrRetailerExists
+				}
+			}
+		}
+
+		return txn.Insert("retailer", retailer)
+	})
+}
+
+func (s *memStore) GetRetailer(id string) (*Retailer, error) {
+	txn := s.db.Txn(false)
+	raw, err := txn.First("retailer", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+
+	return raw.(*Retailer), nil
+}
+
+func (s *memStore) GetRetailers() ([]*Retailer, error) {
+	txn := s.db.Txn(false)
+	it, err := txn.Get("retailer", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var retailers []*Retailer
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		retailers = append(retailers, raw.(*Retailer))
+	}
+	sort.Slice(retailers, func(i, j int) bool {
+		return retailers[i].Name < retailers[j].Name
+	})
+
+	return retailers, nil
+}
+
+func (s *memStore) GetRetailerReceipts(retailerId string) ([]*StoredReceipt, error) {
+	return retailerReceipts(s.db.Txn(false), retailerId)
+}
+
+func retailerReceipts(txn *memdb.Txn, retailerId string) ([]*StoredReceipt, error) {
+	it, err := txn.Get("receipt", "retailer", retailerId)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipts []*StoredReceipt
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		receipts = append(receipts, raw.(*StoredReceipt))
+	}
+
+	return receipts, nil
+}
+
+func (s *memStore) MergeRetailers(targetId string, retailerIds []string) (*Retailer, error) {
+	var merged *Retailer
+	err := s.update(func(txn *memdb.Txn) error {
+		raw, err := txn.First("retailer", "id", targetId)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return ErrNotFound
+		}
+
+		// Stored objects must not be modified, so the target is replaced by a copy.
+		target := *raw.(*Retailer)
+		target.Aliases = append([]string{}, target.Aliases...)
+		for _, retailerId := range retailerIds {
+			if retailerId == targetId {
+				continue
+			}
+			raw, err := txn.First("retailer", "id", retailerId)
+			if err != nil {
+				return err
+			}
+			if raw == nil {
+				return ErrNotFound
+			}
+			retailer := raw.(*Retailer)
+			target.Aliases = append(append(target.Aliases, retailer.Name), retailer.Aliases...)
+
+			receipts, err := retailerReceipts(txn, retailerId)
+			if err != nil {
+				return err
+			}
+			for _, stored := range receipts {
+				moved := *stored
+				moved.RetailerId = targetId
+				if err := txn.Insert("receipt", &moved); err != nil {
+					return err
+				}
+			}
+
+			if err := txn.Delete("retailer", retailer); err != nil {
+				return err
+			}
+		}
+
+		merged = &target
+		return txn.Insert("retailer", merged)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+func (s *memStore) PutCampaign(campaign *receipt.Campaign) error {
+	return s.update(func(txn *memdb.Txn) error {
+		return txn.Insert("campaign", campaign)
+	})
+}
+
+func (s *memStore) GetCampaign(id string) (*receipt.Campaign, error) {
+	txn := s.db.Txn(false)
+	raw, err := txn.First("campaign", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+
+	return raw.(*receipt.Campaign), nil
+}
+
+func (s *memStore) GetCampaigns() ([]*receipt.Campaign, error) {
+	txn := s.db.Txn(false)
+	it, err := txn.Get("campaign", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var campaigns []*receipt.Campaign
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		campaigns = append(campaigns, raw.(*receipt.Campaign))
+	}
+
+	return campaigns, nil
+}
+
+func (s *memStore) DeleteCampaign(id string) error {
+	return s.update(func(txn *memdb.Txn) error {
+		raw, err := txn.First("campaign", "id", id)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return ErrNotFound
+		}
+		return txn.Delete("campaign", raw)
+	})
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
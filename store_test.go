@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
+)
+
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.log")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := uuid.New().String()
+	err = store.InsertReceipt(&StoredReceipt{
+		Id:          id,
+		Points:      28,
+		Rules:       []receipt.RuleResult{{Rule: receipt.RulePurchaseDay, Points: 6, Input: "2022-01-01"}},
+		Receipt:     receipt.Receipt{Retailer: "Target", Total: "35.35"},
+		ProcessedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	stored, err := store.GetReceipt(id)
+	if err != nil {
+		t.Fatal("Receipt was lost on restart")
+	}
+	if stored.Points != 28 || stored.Receipt.Retailer != "Target" || len(stored.Rules) != 1 {
+		t.Error("Receipt was not restored correctly")
+	}
+}
+
+func TestFileStore_IgnoresTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.log")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New().String()
+	store.InsertReceipt(&StoredReceipt{Id: id, Points: 5})
+	store.Close()
+
+	// Simulate a crash in the middle of writing the next record.
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"table":"receipt","object":{"Id":"`)
+	file.Close()
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetReceipt(id); err != nil {
+		t.Error("Receipt before the torn write was lost")
+	}
+	if err := store.InsertReceipt(&StoredReceipt{Id: uuid.New().String(), Points: 5}); err != nil {
+		t.Error("Could not write after recovering")
+	}
+}
+
+// A log file whose writes stop partway through once failing is set.
+type failingFile struct {
+	*os.File
+	failing bool
+}
+
+func (f *failingFile) Write(data []byte) (int, error) {
+	if !f.failing {
+		return f.File.Write(data)
+	}
+	n, _ := f.File.Write(data[:len(data)/2])
+	return n, errors.New("disk full")
+}
+
+func TestFileStore_TruncatesFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.log")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &failingFile{File: store.file.(*os.File)}
+	store.file = file
+
+	id := uuid.New().String()
+	if err := store.InsertReceipt(&StoredReceipt{Id: id, Points: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	file.failing = true
+	failedId := uuid.New().String()
+	if err := store.InsertReceipt(&StoredReceipt{Id: failedId, Points: 5}); err == nil {
+		t.Fatal("Expected the failed write to return an error")
+	}
+	file.failing = false
+
+	laterId := uuid.New().String()
+	if err := store.InsertReceipt(&StoredReceipt{Id: laterId, Points: 5}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatal("Log could not be replayed after a failed write:", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetReceipt(id); err != nil {
+		t.Error("Receipt before the failed write was lost")
+	}
+	if _, err := store.GetReceipt(failedId); err != ErrNotFound {
+		t.Error("Receipt from the failed write was stored")
+	}
+	if _, err := store.GetReceipt(laterId); err != nil {
+		t.Error("Receipt after the failed write was lost")
+	}
+}
+
+func TestMemStore_GetReturnsNotFound(t *testing.T) {
+	store := newMemStore()
+	if _, err := store.GetReceipt(uuid.New().String()); err != ErrNotFound {
+		t.Error("Expected ErrNotFound")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"danielHett/main/receipt"
+)
+
+func processText(store Store, query string, text string) (int, []byte) {
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process"+query, strings.NewReader(text))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	w := httptest.NewRecorder()
+	processHandler(store, testRulebook, defaultConfig, w, req)
+	data, _ := ioutil.ReadAll(w.Result().Body)
+	return w.Result().StatusCode, data
+}
+
+func TestProcessHandler_ReadsTextReceipts(t *testing.T) {
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+
+	status, data := processText(testStore, "?accountId="+accountId, strings.Join([]string{
+		"M&M Corner Market",
+		"03/20/2022 2:33 PM",
+		"4 x Gatorade @ 2.25   9.00",
+		"~~ LOYALTY 0042 ~~",
+		"TOTAL                 9.00",
+	}, "\n"))
+	if status != 200 {
+		t.Fatalf("Could not process the text: %s", data)
+	}
+	var response ProcessResponse
+	json.Unmarshal(data, &response)
+	if len(response.Flags) != 1 || response.Flags[0].Code != receipt.CodeUnparsedLine || response.Flags[0].Field != "lines[3]" {
+		t.Errorf("Expected the loyalty line to be flagged: %s", data)
+	}
+	if balance := getBalance(testStore, accountId); balance != 109 {
+		t.Errorf("Invalid balance: %d", balance)
+	}
+}
+
+func TestProcessHandler_ExplainsUnreadableText(t *testing.T) {
+	testStore := newMemStore()
+
+	status, data := processText(testStore, "", "M&M Corner Market\n03/20/2022 2:33 PM\nGatorade x4\nTOTAL\t9,00")
+	var problem Problem
+	json.Unmarshal(data, &problem)
+	codes := map[string]bool{}
+	for _, err := range problem.Errors {
+		codes[err.Code] = true
+	}
+	if status != 400 || !codes[receipt.CodeMissing] || !codes[receipt.CodeNoItems] || !codes[receipt.CodeUnparsedLine] {
+		t.Errorf("Expected the missing fields and the unparsed lines: %s", data)
+	}
+
+	status, _ = processText(testStore, "?layout=metric", "M&M Corner Market")
+	if status != 400 {
+		t.Errorf("Expected an unknown layout to be refused, got %d", status)
+	}
+}
+
+func TestProcessHandler_HashesTheQueryWithTheText(t *testing.T) {
+	testStore := newMemStore()
+	text := "M&M Corner Market\n03/20/2022 2:33 PM\n4 x Gatorade @ 2.25   9.00\nTOTAL                 9.00"
+	send := func(query string) int {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process"+query, strings.NewReader(text))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Idempotency-Key", "text-1")
+		w := httptest.NewRecorder()
+		processHandler(testStore, testRulebook, defaultConfig, w, req)
+		return w.Result().StatusCode
+	}
+
+	if status := send("?accountId=" + createTestAccount(t, testStore)); status != 200 {
+		t.Fatalf("Could not process the text: %d", status)
+	}
+	if status := send("?accountId=" + createTestAccount(t, testStore)); status != 422 {
+		t.Errorf("Key reused for another account should be refused, got %d", status)
+	}
+}
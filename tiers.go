@@ -0,0 +1,71 @@
+/**
+* This file contains the membership tiers. The tiers themselves are defined by the rules;
+* an account's tier is worked out from its recent receipts whenever it is needed, so
+* accounts are promoted and demoted without anything having to run.
+ */
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"danielHett/main/receipt"
+)
+
+// Models a response to the accounts/{id}/tier endpoint.
+type TierResponse struct {
+	AccountId string `json:"accountId"`
+	receipt.Standing
+}
+
+/**
+* Works out the tier of the account under the engine's rules. The second return value is
+* false if the rules have no tiers.
+ */
+func accountStanding(store Store, engine *receipt.Engine, accountId string, now time.Time) (receipt.Standing, bool, error) {
+	receipts, err := store.GetAccountReceipts(accountId)
+	if err != nil {
+		return receipt.Standing{}, false, err
+	}
+
+	standing, found := engine.Standing(pastReceipts(receipts), now)
+	return standing, found, nil
+}
+
+// Converts the receipts of an account to the history its tier is worked out from.
+// Receipts accepted as duplicates don't count.
+func pastReceipts(receipts []*StoredReceipt) []receipt.PastReceipt {
+	var history []receipt.PastReceipt
+	for _, stored := range receipts {
+		if stored.DuplicateOf == "" {
+			history = append(history, receipt.PastReceipt{Receipt: stored.Receipt, Points: stored.Points, ScoredAt: stored.ProcessedAt})
+		}
+	}
+
+	return history
+}
+
+/**
+* Handler for the /accounts/{id}/tier path. Returns the tier the account's next receipt
+* will be scored in, and what it earned and spent towards it.
+ */
+func tierHandler(store Store, rulebook *receipt.Rulebook, res http.ResponseWriter, req *http.Request) {
+	account, found := findAccount(store, req)
+	if !found {
+		respond(http.StatusNotFound, AccountNotFoundResponse, res)
+		return
+	}
+
+	standing, found, err := accountStanding(store, rulebook.Current(), account.Id, time.Now())
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
+	}
+	if !found {
+		respond(http.StatusNotFound, NoTiersResponse, res)
+		return
+	}
+
+	respondJSON(TierResponse{account.Id, standing}, res)
+}
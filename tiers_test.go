@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"danielHett/main/receipt"
+)
+
+func TestTiers_MultiplyPointsOncePromoted(t *testing.T) {
+	set := receipt.DefaultRuleSet()
+	set.Tiers = &receipt.TierPolicy{Basis: receipt.TierBasisPoints, WindowMonths: 12, Tiers: []receipt.TierConfig{
+		{Name: "bronze", Multiplier: receipt.MustParseDecimal("1")},
+		{Name: "gold", Multiplier: receipt.MustParseDecimal("1.5"), MinPoints: 150},
+	}}
+	rulebook, err := receipt.NewRulebook("", set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore := newMemStore()
+	accountId := createTestAccount(t, testStore)
+
+	getTier := func() TierResponse {
+		req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/tier", nil)
+		w := httptest.NewRecorder()
+		tierHandler(testStore, rulebook, w, req)
+		data, _ := ioutil.ReadAll(w.Result().Body)
+		var tierResponse TierResponse
+		json.Unmarshal(data, &tierResponse)
+		return tierResponse
+	}
+
+	// Two receipts of 75 points reach gold, so the third earns 1.5x.
+	for _, date := range []string{"2022-03-20", "2022-03-22", "2022-03-24"} {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", receiptForAccount(accountId, date))
+		w := httptest.NewRecorder()
+		processHandler(testStore, rulebook, defaultConfig, w, req)
+		if w.Result().StatusCode != 200 {
+			t.Fatalf("Could not process the receipt of %s", date)
+		}
+	}
+
+	receipts, _ := testStore.GetAccountReceipts(accountId)
+	last := receipts[2]
+	if last.Points != 113 || last.Tier == nil || last.Tier.Name != "gold" {
+		t.Errorf("Gold receipt earned %d points in %+v", last.Points, last.Tier)
+	}
+	if rule := last.Rules[len(last.Rules)-1]; rule.Rule != receipt.RuleTierMultiplier || rule.Points != 38 {
+		t.Errorf("Tier is not in the breakdown: %+v", last.Rules)
+	}
+	if receipts[0].Points != 75 || receipts[0].Tier.Name != "bronze" {
+		t.Errorf("Bronze receipt earned %d points", receipts[0].Points)
+	}
+
+	tierResponse := getTier()
+	if tierResponse.Tier.Name != "gold" || tierResponse.Points != 263 || tierResponse.Next != nil {
+		t.Errorf("Invalid tier response: %+v", tierResponse)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/"+accountId+"/tier", nil)
+	w := httptest.NewRecorder()
+	tierHandler(testStore, testRulebook, w, req)
+	if w.Result().StatusCode != 404 {
+		t.Error("Rules without tiers should have no tier")
+	}
+}
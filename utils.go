@@ -1,199 +1,480 @@
 package main
 
 import (
-	"math"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"regexp"
-	"strconv"
+	"runtime"
 	"strings"
-	"unicode"
+	"sync"
+	"time"
 
-	"github.com/hashicorp/go-memdb"
+	"danielHett/main/receipt"
+	"github.com/google/uuid"
 )
 
 /**
-* Creates a new instance of the database for the receipt processor.
+* Scores a receipt with the current rules and the stored campaigns, in the local time of
+* the store, matches its retailer to the catalog, and wraps it, under a fresh id, in the
+* StoredReceipt that is ready to be inserted. A receipt for an account is held to the
+* caps of the campaigns and earns the multiplier of the account's tier, if the rules have
+* tiers. A return or exchange also takes back the points of the items it returns from its
+* original receipt. Receipts purchased in the future or outside the submission window are
+* refused. earlier holds the receipts of the account scored before this one in the same
+* batch, which are not stored yet but count towards its caps and tier all the same.
  */
-func createDB() *memdb.MemDB {
-	var schema = &memdb.DBSchema{
-		Tables: map[string]*memdb.TableSchema{
-			"receipt": &memdb.TableSchema{
-				Name: "receipt",
-				Indexes: map[string]*memdb.IndexSchema{
-					"id": &memdb.IndexSchema{
-						Name:    "id",
-						Unique:  true,
-						Indexer: &memdb.UUIDFieldIndex{Field: "Id"},
-					},
-					"points": &memdb.IndexSchema{
-						Name:    "points",
-						Unique:  false,
-						Indexer: &memdb.IntFieldIndex{Field: "Points"},
-					},
-				},
-			},
-		},
-	}
-
-	db, err := memdb.NewMemDB(schema)
+func scoreReceipt(store Store, rulebook *receipt.Rulebook, config Config, request ProcessRequest, earlier []*StoredReceipt) (*StoredReceipt, error) {
+	r, engine := request.Receipt, rulebook.Current()
+	result, err := engine.Score(r)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if err := receipt.CheckPurchaseDate(r, time.Now(), config.ClockSkew, config.SubmissionWindow); err != nil {
+		return nil, err
+	}
+	local := r.Localized()
+
+	var returned receipt.Result
+	if r.OriginalReceiptId != "" {
+		returned, err = clawBack(store, rulebook, &request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	campaigns, err := store.GetCampaigns()
+	if err != nil {
+		return nil, err
 	}
 
-	return db
+	catalog, err := store.GetRetailers()
+	if err != nil {
+		return nil, err
+	}
+	var retailerId string
+	if retailer := matchRetailer(catalog, r.Retailer); retailer != nil {
+		retailerId = retailer.Id
+	}
+
+	var history []*StoredReceipt
+	if request.AccountId != "" {
+		history, err = store.GetAccountReceipts(request.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, earlier...)
+	}
+	result.ApplyCampaigns(local, campaigns, campaignEarnings(history))
+
+	var tier *receipt.TierConfig
+	if request.AccountId != "" {
+		if standing, found := engine.Standing(pastReceipts(history), time.Now()); found {
+			tier = &standing.Tier
+			result.ApplyTier(*tier)
+		}
+	}
+	result.Points += returned.Points
+	result.Rules = append(result.Rules, returned.Rules...)
+
+	return &StoredReceipt{
+		Id:          uuid.New().String(),
+		Points:      result.Points,
+		Rules:       result.Rules,
+		Flags:       result.Flags,
+		RuleSet:     engine.Version(),
+		Receipt:     r,
+		ProcessedAt: time.Now().UTC(),
+		Fingerprint: receipt.Fingerprint(local),
+		PurchasedAt: r.PurchaseInstant(),
+		AccountId:   request.AccountId,
+		ExpiresAt:   pointsExpiry(local.PurchaseDate, config.PointsExpireMonths),
+		Tier:        tier,
+		RetailerId:  retailerId,
+		ReturnOf:    r.OriginalReceiptId,
+		Currency:    engine.ReceiptCurrency(r),
+	}, nil
+}
+
+// The code of the flag on a receipt that was accepted as a duplicate.
+const DuplicateCode = "duplicate"
+
+// The code of the error for a receipt sent with an accountId that is not stored.
+const UnknownAccountCode = "unknown_account"
+
+// Marks a receipt as a duplicate of the original, so the store accepts it.
+func markDuplicate(stored *StoredReceipt, originalId string) {
+	stored.DuplicateOf = originalId
+	stored.Flags = append(stored.Flags, &receipt.ValidationError{
+		Field:   "receipt",
+		Code:    DuplicateCode,
+		Message: "duplicate of receipt " + originalId,
+	})
 }
 
-/*
-* Given a receipt (ProcessRequest), use the rules provided in the challenge to
-* compute the total points.
+/**
+* Inserts a processed receipt, along with the record of its idempotency key if there is
+* one. The response is built here because it has to be stored with the key. If another
+* receipt has the same fingerprint, a *DuplicateError is returned, or under the flag
+* policy the receipt is marked as a duplicate and inserted anyway.
  */
-func calculatePoints(processRequest *ProcessRequest) (int64, bool) {
-	// Make sure all required fields are present.
-	if processRequest.Retailer == nil ||
-		processRequest.PurchaseDate == nil ||
-		processRequest.PurchaseTime == nil ||
-		processRequest.Items == nil ||
-		processRequest.Total == nil {
+func insertProcessed(store Store, config Config, stored *StoredReceipt, idempotencyKey string, requestHash string) ([]byte, *IdempotencyRecord, error) {
+	for {
+		jData, err := json.Marshal(ProcessResponse{stored.Id, stored.Flags})
+		if err != nil {
+			return nil, nil, err
+		}
 
-		return 0, true
-	}
+		var existing *IdempotencyRecord
+		if idempotencyKey == "" {
+			err = store.InsertReceipt(stored)
+		} else {
+			existing, err = store.InsertReceiptWithKey(stored, &IdempotencyRecord{
+				Key:         idempotencyKey,
+				RequestHash: requestHash,
+				ReceiptId:   stored.Id,
+				Response:    jData,
+				CreatedAt:   stored.ProcessedAt,
+			}, config.IdempotencyWindow)
+		}
 
-	var total int64 = 0
+		var duplicate *DuplicateError
+		if errors.As(err, &duplicate) && config.Duplicates == DuplicatesFlag && stored.DuplicateOf == "" {
+			markDuplicate(stored, duplicate.OriginalId)
+			continue
+		}
 
-	total += getRetailerPoints(processRequest.Retailer)
+		return jData, existing, err
+	}
+}
+
+/**
+* Inserts every scored receipt of a batch in one transaction. Duplicates, receipts for
+* unknown accounts and returns of items already returned are refused by clearing their
+* receipt and setting their problem, or duplicates under the flag policy are marked and
+* inserted in a second transaction.
+ */
+func insertBatch(store Store, config Config, stored []*StoredReceipt, problems []*Problem) error {
+	var indexes []int
+	var valid []*StoredReceipt
+	for i, s := range stored {
+		if s != nil {
+			indexes = append(indexes, i)
+			valid = append(valid, s)
+		}
+	}
 
-	// Get the points for the number of items on the receipt. If there are no
-	// items return an error to the client.
-	if len(*processRequest.Items) == 0 {
-		return 0, true
+	refusedErrs, err := store.InsertReceipts(valid)
+	if err != nil {
+		return err
 	}
 
-	// Rule: 5 points for every two items on the receipt.
-	total += 5 * int64(len(*processRequest.Items)/2)
+	var flagged []*StoredReceipt
+	for j, err := range refusedErrs {
+		i := indexes[j]
+		if errors.Is(err, ErrUnknownAccount) {
+			problem := unknownAccountProblem()
+			stored[i], problems[i] = nil, &problem
+			continue
+		}
+		var invalid receipt.ValidationErrors
+		if errors.As(err, &invalid) {
+			problem := invalidProblem(err)
+			stored[i], problems[i] = nil, &problem
+			continue
+		}
+
+		duplicate, ok := err.(*DuplicateError)
+		if !ok {
+			continue
+		}
+
+		if config.Duplicates == DuplicatesFlag {
+			markDuplicate(stored[i], duplicate.OriginalId)
+			flagged = append(flagged, stored[i])
+		} else {
+			problem := duplicateProblem(duplicate)
+			stored[i], problems[i] = nil, &problem
+		}
+	}
 
-	points, err := getTotalPoints(processRequest.Total)
-	if err {
-		return 0, true
+	if len(flagged) > 0 {
+		_, err = store.InsertReceipts(flagged)
 	}
-	total += points
 
-	for _, item := range *processRequest.Items {
-		points, err := getItemPoints(&item)
-		if err {
-			return 0, true
+	return err
+}
+
+/**
+* Decodes and scores a batch of receipts, spread over one worker per CPU. The receipts of
+* an account are scored one after the other by the same worker, each after the ones
+* before it, so that together they are held to the caps of campaigns. For each receipt
+* either its StoredReceipt or the problem with it is set, at the same index.
+ */
+func scoreBatch(store Store, rulebook *receipt.Rulebook, config Config, rawReceipts []json.RawMessage) ([]*StoredReceipt, []*Problem) {
+	stored := make([]*StoredReceipt, len(rawReceipts))
+	problems := make([]*Problem, len(rawReceipts))
+
+	requests := make([]ProcessRequest, len(rawReceipts))
+	var groups [][]int
+	accountGroups := map[string]int{}
+	for i, raw := range rawReceipts {
+		if err := json.Unmarshal(raw, &requests[i]); err != nil {
+			problem := invalidProblem(err)
+			problems[i] = &problem
+			continue
+		}
+
+		accountId := requests[i].AccountId
+		if g, found := accountGroups[accountId]; found && accountId != "" {
+			groups[g] = append(groups[g], i)
+			continue
 		}
-		total += points
+		accountGroups[accountId] = len(groups)
+		groups = append(groups, []int{i})
 	}
 
-	points, err = getPurchaseTimePoints(processRequest.PurchaseTime)
-	if err {
-		return 0, true
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				var earlier []*StoredReceipt
+				for _, i := range group {
+					var err error
+					stored[i], err = scoreReceipt(store, rulebook, config, requests[i], earlier)
+					if err != nil {
+						problem := invalidProblem(err)
+						problems[i] = &problem
+						continue
+					}
+					earlier = append(earlier, stored[i])
+				}
+			}
+		}()
 	}
-	total += points
 
-	points, err = getPurchaseDayPoints(processRequest.PurchaseDate)
-	if err {
-		return 0, true
+	for _, group := range groups {
+		work <- group
 	}
-	total += points
+	close(work)
+	wg.Wait()
 
-	return total, false
+	return stored, problems
 }
 
-// Rule: One point for every alphanumeric character in the retailer name.
-func getRetailerPoints(s *string) int64 {
-	var count int64 = 0
-	for _, c := range *s {
-		if unicode.IsLetter(c) || unicode.IsNumber(c) {
-			count++
+// Splits an NDJSON body into its lines, skipping blank ones.
+func splitLines(body []byte) []json.RawMessage {
+	var lines []json.RawMessage
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			lines = append(lines, line)
 		}
 	}
 
-	return count
+	return lines
 }
 
-// Rule: 50 points if the total is a round dollar amount with no cents.
-// AND
-// Rule: 25 points if the total is a multiple of 0.25.
-func getTotalPoints(total *string) (int64, bool) {
-	var points int64 = 0
-	r := regexp.MustCompile(`^[0-9]+\.[0-9][0-9]$`)
-	if !r.Match([]byte(*total)) {
-		return 0, true
+/**
+* Returns the id in the path of the request (receipts/{id}/..., accounts/{id}/...,
+* campaigns/{id} or retailers/{id}/...). The second return value is false if it is not a
+* valid uuid.
+ */
+func pathId(req *http.Request) (string, bool) {
+	urlParts := strings.Split(req.URL.Path, "/")
+	if len(urlParts) < 3 {
+		return "", false
 	}
 
-	centsAmount, _ := strconv.Atoi(strings.Split(*total, ".")[1])
-	if centsAmount == 0 {
-		points += 50
+	_, err := uuid.Parse(urlParts[2])
+	return urlParts[2], err == nil
+}
+
+/**
+* Looks up the receipt whose id is in the path of the request. The second return value
+* is false if the id is not a valid uuid or is not in the store.
+ */
+func findReceipt(store Store, req *http.Request) (*StoredReceipt, bool) {
+	receiptId, ok := pathId(req)
+	if !ok {
+		// There wasn't a valid uuid.
+		return nil, false
 	}
 
-	if (centsAmount % 25) == 0 {
-		points += 25
+	// Try retrieving the receipt from the store.
+	stored, err := store.GetReceipt(receiptId)
+	if err != nil {
+		// Couldn't find the id.
+		return nil, false
 	}
 
-	return points, false
+	return stored, true
 }
 
-// Rule: If the trimmed length of the item description is a multiple of 3, multiply the price
-// by 0.2 and round up to the nearest integer. The result is the number of points earned.
-func getItemPoints(item *Item) (int64, bool) {
-	if item.ShortDescription == nil || item.Price == nil {
-		return 0, true
+/**
+* Looks up the account whose id is in the path of the request. The second return value
+* is false if the id is not a valid uuid or is not in the store.
+ */
+func findAccount(store Store, req *http.Request) (*Account, bool) {
+	accountId, ok := pathId(req)
+	if !ok {
+		return nil, false
 	}
 
-	trimmedDesc := strings.TrimSpace(*item.ShortDescription)
-	if len(trimmedDesc)%3 != 0 {
-		return 0, false
+	account, err := store.GetAccount(accountId)
+	if err != nil {
+		return nil, false
 	}
 
-	r := regexp.MustCompile(`^[0-9]+\.[0-9][0-9]$`)
-	if !r.Match([]byte(*item.Price)) {
-		return 0, true
+	return account, true
+}
+
+/**
+* Looks up the campaign whose id is in the path of the request. The second return value
+* is false if the id is not a valid uuid or is not in the store.
+ */
+func findCampaign(store Store, req *http.Request) (*receipt.Campaign, bool) {
+	campaignId, ok := pathId(req)
+	if !ok {
+		return nil, false
 	}
 
-	price, _ := strconv.ParseFloat(*item.Price, 64)
+	campaign, err := store.GetCampaign(campaignId)
+	if err != nil {
+		return nil, false
+	}
 
-	return int64(math.Ceil(0.2 * price)), false
+	return campaign, true
 }
 
-// Rule: 6 points if the day in the purchase date is odd.
-func getPurchaseDayPoints(date *string) (int64, bool) {
-	r := regexp.MustCompile(`^\d{4}\-(0[1-9]|1[012])\-(0[1-9]|[12][0-9]|3[01])$`)
-	if !r.Match([]byte(*date)) {
-		return 0, true
+// Returned by storedResult when the requested rule set is not in the rulebook.
+var errUnknownRuleSet = errors.New("unknown rule set")
+
+/**
+* Returns the result a stored receipt was given and the version of the rules that gave
+* it. If a version is requested and it differs from the stored one, the receipt is
+* scored again under that version instead, keeping the campaign points it earned, the
+* tier it was scored in and the points it took back from its original receipt.
+ */
+func storedResult(rulebook *receipt.Rulebook, stored *StoredReceipt, version string) (receipt.Result, string, error) {
+	if version == "" || version == stored.RuleSet {
+		return receipt.Result{Points: stored.Points, Rules: stored.Rules, Flags: stored.Flags}, stored.RuleSet, nil
+	}
+
+	engine, found := rulebook.Engine(version)
+	if !found {
+		return receipt.Result{}, "", errUnknownRuleSet
+	}
+
+	result, err := engine.Score(stored.Receipt)
+	if err != nil {
+		return receipt.Result{}, "", err
+	}
+	for _, rule := range stored.Rules {
+		if rule.Campaign != "" {
+			result.Points += rule.Points
+			result.Rules = append(result.Rules, rule)
+		}
+	}
+	if stored.Tier != nil {
+		result.ApplyTier(*stored.Tier)
 	}
+	for _, rule := range stored.Rules {
+		if rule.ReturnedFrom != "" {
+			result.Points += rule.Points
+			result.Rules = append(result.Rules, rule)
+		}
+	}
+
+	return result, version, nil
+}
 
-	day, _ := strconv.ParseInt(strings.Split(*date, "-")[2], 10, 64)
-	if day%2 == 1 {
-		return 6, false
+// Responds to a failure of storedResult.
+func respondScoreError(err error, res http.ResponseWriter) {
+	if errors.Is(err, errUnknownRuleSet) {
+		respond(http.StatusBadRequest, UnknownRuleSetResponse, res)
 	} else {
-		return 0, false
+		respondInvalid(err, res)
 	}
 }
 
-// Rule: 10 points if the time of purchase is after 2:00pm and before 4:00pm.
-func getPurchaseTimePoints(time *string) (int64, bool) {
-	r := regexp.MustCompile(`^([01]\d|2[0-3]):([0-5]\d)$`)
-	if !r.Match([]byte(*time)) {
-		return 0, true
+// Sends an error back to the client as a problem with the given title.
+func respond(code int, title string, res http.ResponseWriter) {
+	respondProblem(Problem{Type: "about:blank", Title: title, Status: code}, res)
+}
+
+/**
+* Sends an error back to the client for a receipt that could not be read or failed
+* validation. If err is a receipt.ValidationErrors every invalid field is listed.
+ */
+func respondInvalid(err error, res http.ResponseWriter) {
+	respondProblem(invalidProblem(err), res)
+}
+
+// Builds the problem sent by respondInvalid.
+func invalidProblem(err error) Problem {
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  InvalidBodyResponse,
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	}
+
+	var errs receipt.ValidationErrors
+	if errors.As(err, &errs) {
+		problem.Errors = errs
 	}
 
-	splitTime := strings.Split(*time, ":")
-	hour, _ := strconv.ParseInt(splitTime[0], 10, 64)
-	minute, _ := strconv.ParseInt(splitTime[1], 10, 64)
+	return problem
+}
 
-	isAfter2 := hour > 14 || (hour == 14 && minute > 0)
-	isBefore4 := hour < 16
+// Builds the problem sent for a receipt that duplicates a stored one.
+func duplicateProblem(duplicate *DuplicateError) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     DuplicateReceiptResponse,
+		Status:    http.StatusConflict,
+		Detail:    duplicate.Error(),
+		ReceiptId: duplicate.OriginalId,
+	}
+}
 
-	if isAfter2 && isBefore4 {
-		return 10, false
-	} else {
-		return 0, false
+// Builds the problem sent for a receipt whose accountId is not a stored account.
+func unknownAccountProblem() Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  InvalidBodyResponse,
+		Status: http.StatusBadRequest,
+		Detail: "accountId: " + AccountNotFoundResponse,
+		Errors: []*receipt.ValidationError{{Field: "accountId", Code: UnknownAccountCode, Message: AccountNotFoundResponse}},
+	}
+}
+
+// Sends a successful response back to the client as a JSON body.
+func respondJSON(response interface{}, res http.ResponseWriter) {
+	jData, err := json.Marshal(response)
+	if err != nil {
+		respond(http.StatusInternalServerError, ServerErrorResponse, res)
+		return
 	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(jData)
 }
 
-// Sends a message back to the client.
-func respond(code int, message []byte, res http.ResponseWriter) {
-	res.WriteHeader(code)
-	res.Write(message)
+// Sends a problem back to the client as an application/problem+json body.
+func respondProblem(problem Problem, res http.ResponseWriter) {
+	jData, err := json.Marshal(problem)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/problem+json")
+	res.WriteHeader(problem.Status)
+	res.Write(jData)
 }